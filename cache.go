@@ -0,0 +1,109 @@
+package srs
+
+import (
+	"bytes"
+	"container/list"
+	"strconv"
+	"sync"
+)
+
+// lruCache of Forward results, safe for concurrent use
+type lruCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+// cacheEntry is forward result with secret it was signed with
+type cacheEntry struct {
+	key    string
+	secret []byte
+	fwd    string
+}
+
+// newLRUCache returns cache with size entries
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// get returns cached forward address for key if it was signed with secret
+func (c *lruCache) get(key string, secret []byte) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+	entry := e.Value.(*cacheEntry)
+	if !bytes.Equal(entry.secret, secret) {
+		c.ll.Remove(e)
+		delete(c.items, key)
+		return "", false
+	}
+	c.ll.MoveToFront(e)
+	return entry.fwd, true
+}
+
+// add forward address for key, evicting least recently used entry if full
+func (c *lruCache) add(key string, secret []byte, fwd string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		e.Value = &cacheEntry{key: key, secret: secret, fwd: fwd}
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&cacheEntry{key: key, secret: secret, fwd: fwd})
+	if c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*cacheEntry).key)
+	}
+}
+
+// cachedForward returns forward address from cache c or forwards and caches it.
+// Key includes time slot, since forward address changes with timestamp.
+// Cache is bypassed with RandomNonce, since every forward must differ.
+func (srs *SRS) cachedForward(c *lruCache, email string) (string, error) {
+	if c == nil || srs.RandomNonce {
+		return srs.forward(email)
+	}
+
+	slot, err := srs.timestamp()
+	if err != nil {
+		return "", err
+	}
+	key := strconv.Itoa(slot) + sep + email
+	if fwd, ok := c.get(key, srs.primarySecret()); ok {
+		return fwd, nil
+	}
+
+	fwd, err := srs.forward(email)
+	if err == nil {
+		c.add(key, srs.primarySecret(), fwd)
+	}
+	return fwd, err
+}
+
+// ForwardOnce returns SRS forward address like Forward, memoized for the last
+// sender within the current time slot, for loops forwarding mail of one sender
+// to many recipients. SRS address depends only on the sender, not on the
+// recipient. The cache is used instead if CacheSize is set.
+func (srs *SRS) ForwardOnce(email string) (string, error) {
+	if err := srs.setDefaults(); err != nil {
+		return "", err
+	}
+
+	c := srs.cache
+	if c == nil {
+		c = srs.last
+	}
+	fwd, err := srs.cachedForward(c, email)
+	srs.stats.count(err, &srs.stats.forwards)
+	return fwd, err
+}
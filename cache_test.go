@@ -0,0 +1,114 @@
+package srs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mileusna/srs"
+)
+
+func TestCacheSize(t *testing.T) {
+	now := time.Date(2021, 3, 5, 10, 0, 0, 0, time.UTC)
+	misses := 0
+	s := srs.SRS{
+		Secret:    []byte(secret),
+		Domain:    localdomain,
+		CacheSize: 2,
+		NowFunc:   func() time.Time { return now },
+		Store:     func(srsLocal, original string) { misses++ },
+	}
+
+	forward := func(email string, miss bool) string {
+		t.Helper()
+		before := misses
+		fwd, err := s.Forward(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (misses > before) != miss {
+			t.Errorf("Forward %s at %s: expected cache miss %v", email, now, miss)
+		}
+		return fwd
+	}
+
+	fwd := forward("milos@mailspot.com", true)
+	if cached := forward("milos@mailspot.com", false); cached != fwd {
+		t.Errorf("Forward: expected cached %s, got %s", fwd, cached)
+	}
+
+	// later in the same slot
+	now = now.Add(10 * time.Hour)
+	forward("milos@mailspot.com", false)
+
+	// next slot has new timestamp
+	now = now.Add(5 * time.Hour)
+	if next := forward("milos@mailspot.com", true); next == fwd {
+		t.Errorf("Forward: expected new address in next slot, got %s", next)
+	}
+
+	// least recently used address is evicted
+	forward("a@mailspot.com", true)
+	forward("b@mailspot.com", true)
+	forward("milos@mailspot.com", true)
+	forward("b@mailspot.com", false)
+
+	// secret rotation invalidates cached addresses
+	fwd = forward("b@mailspot.com", false)
+	s.Secret = []byte("new secret")
+	if rotated := forward("b@mailspot.com", true); rotated == fwd {
+		t.Errorf("Forward: expected new address after secret rotation, got %s", rotated)
+	}
+
+	if stats := s.Stats(); stats.Forwards != 10 {
+		t.Errorf("Stats: expected cache hits to be counted, got %d forwards", stats.Forwards)
+	}
+}
+
+func TestForwardOnce(t *testing.T) {
+	now := time.Date(2021, 3, 5, 10, 0, 0, 0, time.UTC)
+	misses := 0
+	s := srs.SRS{
+		Secret:  []byte(secret),
+		Domain:  localdomain,
+		NowFunc: func() time.Time { return now },
+		Store:   func(srsLocal, original string) { misses++ },
+	}
+
+	// fan-out of one sender to many recipients forwards the sender once,
+	// SRS address doesn't depend on recipient
+	var fwd string
+	for _, rcpt := range []string{"a@example.com", "b@example.com", "c@example.org"} {
+		f, err := s.ForwardOnce("milos@mailspot.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fwd != "" && f != fwd {
+			t.Errorf("ForwardOnce for %s: expected %s, got %s", rcpt, fwd, f)
+		}
+		fwd = f
+	}
+	if misses != 1 {
+		t.Errorf("ForwardOnce: expected 1 forward, got %d", misses)
+	}
+	if plain, _ := s.Forward("milos@mailspot.com"); plain != fwd {
+		t.Errorf("ForwardOnce: expected same address as Forward %s, got %s", plain, fwd)
+	}
+
+	// memoization is scoped to time slot
+	now = now.Add(24 * time.Hour)
+	next, err := s.ForwardOnce("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == fwd {
+		t.Errorf("ForwardOnce: expected new address in next slot, got %s", next)
+	}
+
+	// other sender replaces memoized one
+	misses = 0
+	s.ForwardOnce("other@mailspot.com")
+	s.ForwardOnce("milos@mailspot.com")
+	if misses != 2 {
+		t.Errorf("ForwardOnce: expected 2 forwards, got %d", misses)
+	}
+}
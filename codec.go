@@ -0,0 +1,27 @@
+package srs
+
+// TimestampCodec encodes time slot to timestamp field of SRS0 address and
+// decodes it back
+type TimestampCodec interface {
+	Encode(slot int) string
+	Decode(ts string) (int, error)
+}
+
+// base32Codec is the default codec of postsrsd and other implementations
+type base32Codec struct{}
+
+func (base32Codec) Encode(slot int) string {
+	return base32Encode(slot)
+}
+
+func (base32Codec) Decode(ts string) (int, error) {
+	return Base32Decode(ts)
+}
+
+// codec returns TimestampCodec or base32 codec
+func (srs SRS) codec() TimestampCodec {
+	if srs.TimestampCodec != nil {
+		return srs.TimestampCodec
+	}
+	return base32Codec{}
+}
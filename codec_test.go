@@ -0,0 +1,76 @@
+package srs_test
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mileusna/srs"
+)
+
+var errBadHex = errors.New("bad hex timestamp")
+
+// hexCodec encodes timestamp as lower-case hex
+type hexCodec struct{}
+
+func (hexCodec) Encode(slot int) string {
+	return strconv.FormatInt(int64(slot), 16)
+}
+
+func (hexCodec) Decode(ts string) (int, error) {
+	x, err := strconv.ParseInt(ts, 16, 32)
+	if err != nil {
+		return 0, errBadHex
+	}
+	return int(x), nil
+}
+
+func TestTimestampCodec(t *testing.T) {
+	minted := time.Unix(1000*24*60*60+3600, 0)
+	now := minted
+	s := srs.SRS{
+		Secret:         []byte(secret),
+		Domain:         localdomain,
+		TimestampCodec: hexCodec{},
+		TimeSlots:      512,
+		NowFunc:        func() time.Time { return now },
+	}
+
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// day 1000 is slot 488 in cycle of 512 days
+	if ts := strings.Split(fwd, "=")[2]; ts != "1e8" {
+		t.Errorf("Forward: expected hex timestamp 1e8, got %s", fwd)
+	}
+	if slot, err := s.TimeSlot(fwd); slot != 488 || err != nil {
+		t.Errorf("TimeSlot %s: expected 488, got %d %v", fwd, slot, err)
+	}
+
+	for _, tc := range []struct {
+		days int
+		err  error
+	}{
+		{0, nil},
+		{21, nil},
+		{22, srs.ErrTimestampExpired},
+	} {
+		now = minted.AddDate(0, 0, tc.days)
+		if rvs, err := s.Reverse(fwd); err != tc.err || err == nil && rvs != "milos@mailspot.com" {
+			t.Errorf("Reverse %s after %d days: expected %v, got %s %v", fwd, tc.days, tc.err, rvs, err)
+		}
+	}
+
+	// base32 address is rejected by hex codec
+	now = minted
+	b32, err := (&srs.SRS{Secret: []byte(secret), Domain: localdomain, NowFunc: s.NowFunc}).Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rvs, err := s.Reverse(b32); err != errBadHex {
+		t.Errorf("Reverse %s: expected %v, got %s %v", b32, errBadHex, rvs, err)
+	}
+}
@@ -0,0 +1,57 @@
+package srs
+
+import "errors"
+
+// errorCodes are stable machine readable codes of package errors
+var errorCodes = map[error]string{
+	ErrNoAtSign:               "NO_AT_SIGN",
+	ErrBadFormat:              "BAD_FORMAT",
+	ErrNotSRS:                 "NOT_SRS",
+	ErrBadURLEncoding:         "BAD_URL_ENCODING",
+	ErrNoUserSRS0:             "NO_USER_SRS0",
+	ErrNoUserSRS1:             "NO_USER_SRS1",
+	ErrHashTooShort:           "HASH_TOO_SHORT",
+	ErrHashInvalid:            "HASH_INVALID",
+	ErrTimestampInvalidBase32: "TS_INVALID",
+	ErrTimestampExpired:       "TS_EXPIRED",
+	ErrHashTooShortConfig:     "CONFIG_HASH_TOO_SHORT",
+	ErrHashTooLongConfig:      "CONFIG_HASH_TOO_LONG",
+	ErrSchemeTagConfig:        "CONFIG_SCHEME_TAG",
+	ErrMaxAgeConfig:           "CONFIG_MAX_AGE",
+	ErrTimeSlotsConfig:        "CONFIG_TIME_SLOTS",
+	ErrInvalidDomain:          "INVALID_DOMAIN",
+	ErrUnicodeConfig:          "CONFIG_UNICODE",
+	ErrInvalidNow:             "INVALID_NOW",
+	ErrInputTooLong:           "INPUT_TOO_LONG",
+	ErrWrongDomain:            "WRONG_DOMAIN",
+	ErrImplausibleFields:      "IMPLAUSIBLE_FIELDS",
+	ErrEmptyDomain:            "EMPTY_DOMAIN",
+	ErrUnsafeAddress:          "UNSAFE_ADDRESS",
+	ErrSRS1Rejected:           "SRS1_REJECTED",
+	ErrSRS1HashInvalid:        "SRS1_HASH_INVALID",
+	ErrSRS0HashInvalid:        "SRS0_HASH_INVALID",
+	ErrNoSecret:               "NO_SECRET",
+	ErrWeakSecret:             "WEAK_SECRET",
+	ErrSecretConfig:           "CONFIG_SECRET",
+	ErrNoVERP:                 "NO_VERP",
+	ErrVERPNotRewritten:       "VERP_NOT_REWRITTEN",
+	ErrUnsupportedVersion:     "UNSUPPORTED_VERSION",
+	ErrVersionConfig:          "CONFIG_VERSION",
+	ErrFieldLayoutConfig:      "CONFIG_FIELD_LAYOUT",
+	ErrCompatibilityConfig:    "CONFIG_COMPATIBILITY",
+}
+
+// Code returns stable code of package error for structured logging, like
+// HASH_INVALID, TS_EXPIRED or NOT_SRS. Wrapped errors are unwrapped, nil
+// error returns empty string and other errors return UNKNOWN.
+func Code(err error) string {
+	if err == nil {
+		return ""
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if code, ok := errorCodes[e]; ok {
+			return code
+		}
+	}
+	return "UNKNOWN"
+}
@@ -0,0 +1,68 @@
+package srs_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mileusna/srs"
+)
+
+func TestCode(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		code string
+	}{
+		{srs.ErrNoAtSign, "NO_AT_SIGN"},
+		{srs.ErrBadFormat, "BAD_FORMAT"},
+		{srs.ErrNotSRS, "NOT_SRS"},
+		{srs.ErrBadURLEncoding, "BAD_URL_ENCODING"},
+		{srs.ErrNoUserSRS0, "NO_USER_SRS0"},
+		{srs.ErrNoUserSRS1, "NO_USER_SRS1"},
+		{srs.ErrHashTooShort, "HASH_TOO_SHORT"},
+		{srs.ErrHashInvalid, "HASH_INVALID"},
+		{srs.ErrTimestampInvalidBase32, "TS_INVALID"},
+		{srs.ErrTimestampExpired, "TS_EXPIRED"},
+		{srs.ErrHashTooShortConfig, "CONFIG_HASH_TOO_SHORT"},
+		{srs.ErrHashTooLongConfig, "CONFIG_HASH_TOO_LONG"},
+		{srs.ErrSchemeTagConfig, "CONFIG_SCHEME_TAG"},
+		{srs.ErrMaxAgeConfig, "CONFIG_MAX_AGE"},
+		{srs.ErrTimeSlotsConfig, "CONFIG_TIME_SLOTS"},
+		{srs.ErrInvalidDomain, "INVALID_DOMAIN"},
+		{srs.ErrUnicodeConfig, "CONFIG_UNICODE"},
+		{srs.ErrInvalidNow, "INVALID_NOW"},
+		{srs.ErrInputTooLong, "INPUT_TOO_LONG"},
+		{srs.ErrWrongDomain, "WRONG_DOMAIN"},
+		{srs.ErrImplausibleFields, "IMPLAUSIBLE_FIELDS"},
+		{srs.ErrEmptyDomain, "EMPTY_DOMAIN"},
+		{srs.ErrUnsafeAddress, "UNSAFE_ADDRESS"},
+		{srs.ErrSRS1Rejected, "SRS1_REJECTED"},
+		{srs.ErrSRS1HashInvalid, "SRS1_HASH_INVALID"},
+		{srs.ErrSRS0HashInvalid, "SRS0_HASH_INVALID"},
+		{srs.ErrNoSecret, "NO_SECRET"},
+		{srs.ErrWeakSecret, "WEAK_SECRET"},
+		{srs.ErrSecretConfig, "CONFIG_SECRET"},
+		{srs.ErrNoVERP, "NO_VERP"},
+		{srs.ErrVERPNotRewritten, "VERP_NOT_REWRITTEN"},
+		{srs.ErrUnsupportedVersion, "UNSUPPORTED_VERSION"},
+		{srs.ErrVersionConfig, "CONFIG_VERSION"},
+		{srs.ErrFieldLayoutConfig, "CONFIG_FIELD_LAYOUT"},
+		{srs.ErrCompatibilityConfig, "CONFIG_COMPATIBILITY"},
+		{fmt.Errorf("reverse: %w", srs.ErrHashInvalid), "HASH_INVALID"},
+		{errors.New("other"), "UNKNOWN"},
+		{nil, ""},
+	} {
+		if code := srs.Code(tc.err); code != tc.code {
+			t.Errorf("Code %v: expected %s, got %s", tc.err, tc.code, code)
+		}
+	}
+
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	_, err := s.Reverse("SRS0=XXXX=IS=netmark.rs=milos@" + localdomain)
+	if code := srs.Code(err); code != "HASH_INVALID" || !errors.Is(err, srs.ErrHashInvalid) {
+		t.Errorf("Code: expected HASH_INVALID, got %s %v", code, err)
+	}
+}
@@ -0,0 +1,54 @@
+package srs
+
+import "errors"
+
+// Compatibility preset of options matching other SRS implementation
+type Compatibility int
+
+// Compatibility presets set only FirstSeparator, HashLength and MaxAge. Hash,
+// its encoding and truncation, and field layout of these implementations are
+// the same as the default of this package, HMAC-SHA1 encoded to base64 and
+// then truncated, with hash before timestamp, so presets don't set them.
+// Implementations with other hashing scheme, like native SRS of Exim, are
+// not supported.
+const (
+	CompatNone     Compatibility = iota // no preset
+	CompatPostSRSd                      // postsrsd, = separator, 4 characters hash, max age 21 days
+	CompatMailSRS                       // Perl Mail::SRS, = separator, 4 characters hash, max age 31 days
+)
+
+// ErrCompatibilityConfig is returned for unknown Compatibility
+var ErrCompatibilityConfig = errors.New("Compatibility unknown")
+
+// preset options of Compatibility
+type preset struct {
+	separator  string
+	hashLength int
+	maxAge     int
+}
+
+var presets = map[Compatibility]preset{
+	CompatPostSRSd: {separator: "=", hashLength: hashLength, maxAge: maxAge},
+	CompatMailSRS:  {separator: "=", hashLength: hashLength, maxAge: 31},
+}
+
+// applyCompatibility sets options of Compatibility preset which are not set
+func (srs *SRS) applyCompatibility() error {
+	if srs.Compatibility == CompatNone {
+		return nil
+	}
+	p, ok := presets[srs.Compatibility]
+	if !ok {
+		return ErrCompatibilityConfig
+	}
+	if srs.FirstSeparator == "" {
+		srs.FirstSeparator = p.separator
+	}
+	if srs.HashLength == 0 {
+		srs.HashLength = p.hashLength
+	}
+	if srs.MaxAge == 0 {
+		srs.MaxAge = p.maxAge
+	}
+	return nil
+}
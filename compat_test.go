@@ -0,0 +1,68 @@
+package srs_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mileusna/srs"
+)
+
+func TestCompatibility(t *testing.T) {
+	minted := time.Date(2021, 3, 10, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		compat srs.Compatibility
+		maxAge int
+	}{
+		{srs.CompatPostSRSd, 21},
+		{srs.CompatMailSRS, 31},
+	} {
+		now := minted
+		s := srs.SRS{Secret: []byte(secret), Domain: localdomain, Compatibility: tc.compat, NowFunc: func() time.Time { return now }}
+		for _, email := range []string{"milos@mailspot.com", "SRS0=8Zzm=IS=netmark.rs=milos@domain.com"} {
+			now = minted
+			fwd, err := s.Forward(email)
+			if err != nil || !strings.HasPrefix(fwd, "SRS") || strings.Split(fwd, "=")[1] == "" {
+				t.Errorf("Forward %s with preset %d: got %s %v", email, tc.compat, fwd, err)
+				continue
+			}
+			if rvs, err := s.Reverse(fwd); rvs != email || err != nil {
+				t.Errorf("Reverse %s with preset %d: expected %s, got %s %v", fwd, tc.compat, email, rvs, err)
+			}
+		}
+
+		fwd, err := s.Forward("milos@mailspot.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		now = minted.AddDate(0, 0, tc.maxAge)
+		if _, err := s.Reverse(fwd); err != nil {
+			t.Errorf("Reverse %s with preset %d after %d days: %v", fwd, tc.compat, tc.maxAge, err)
+		}
+		now = minted.AddDate(0, 0, tc.maxAge+1)
+		if _, err := s.Reverse(fwd); err != srs.ErrTimestampExpired {
+			t.Errorf("Reverse %s with preset %d after %d days: expected %v, got %v", fwd, tc.compat, tc.maxAge+1, srs.ErrTimestampExpired, err)
+		}
+	}
+
+	// options set explicitly override the preset
+	s := srs.SRS{Secret: []byte(secret), Domain: localdomain, Compatibility: srs.CompatMailSRS, FirstSeparator: "+", HashLength: 6}
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil || !strings.HasPrefix(fwd, "SRS0+") || len(strings.Split(fwd[5:], "=")[0]) != 6 {
+		t.Errorf("Forward with overridden preset: expected SRS0+ and 6 characters hash, got %s %v", fwd, err)
+	}
+
+	// preset doesn't enable lenient parsing, it can be set explicitly
+	for _, lenient := range []bool{false, true} {
+		s := srs.SRS{Secret: []byte(secret), Domain: localdomain, Compatibility: srs.CompatPostSRSd, Lenient: lenient}
+		_, err := s.Forward("SRS0=opaque+string@domain.com")
+		if lenient && err != nil || !lenient && err != srs.ErrNoUserSRS0 {
+			t.Errorf("Forward SRS0=opaque+string@domain.com with Lenient %v: got %v", lenient, err)
+		}
+	}
+
+	bad := srs.SRS{Secret: []byte(secret), Domain: localdomain, Compatibility: 42}
+	if err := bad.Validate(); err != srs.ErrCompatibilityConfig {
+		t.Errorf("Validate: expected %v, got %v", srs.ErrCompatibilityConfig, err)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !srs_nomail
+// +build !srs_nomail
+
+package srs
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// parseEmail and return username and domain name
+func parseEmail(e string) (user, domain string, err error) {
+	if !strings.ContainsRune(e, '@') {
+		return "", "", ErrNoAtSign
+	}
+
+	addr, err := mail.ParseAddress(e)
+	if err != nil {
+		return "", "", ErrBadFormat
+	}
+	// quoted local part may contain at sign, domain can't
+	at := strings.LastIndex(addr.Address, "@")
+	if at == -1 {
+		return "", "", ErrNoAtSign
+	}
+	return addr.Address[:at], addr.Address[at+1:], nil
+}
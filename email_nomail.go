@@ -0,0 +1,21 @@
+//go:build srs_nomail
+// +build srs_nomail
+
+package srs
+
+import "strings"
+
+// parseEmail and return username and domain name, minimal parser for builds
+// without net/mail which accepts only plain local@domain addresses
+func parseEmail(e string) (user, domain string, err error) {
+	at := strings.IndexByte(e, '@')
+	if at == -1 {
+		return "", "", ErrNoAtSign
+	}
+
+	user, domain = e[:at], e[at+1:]
+	if !isDotAtom(user) || !isDotAtom(domain) {
+		return "", "", ErrBadFormat
+	}
+	return user, domain, nil
+}
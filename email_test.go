@@ -0,0 +1,35 @@
+package srs
+
+import "testing"
+
+// common cases which have to be parsed the same with and without srs_nomail build tag
+func TestParseEmail(t *testing.T) {
+	for _, tc := range []struct {
+		email  string
+		user   string
+		domain string
+		err    error
+	}{
+		{"milos@mailspot.com", "milos", "mailspot.com", nil},
+		{"Milos@MailSpot.com", "Milos", "MailSpot.com", nil},
+		{"milosmileusnic@domain", "milosmileusnic", "domain", nil},
+		{"hello+world@domain.com", "hello+world", "domain.com", nil},
+		{"milos.mileusnic@domain.co.uk", "milos.mileusnic", "domain.co.uk", nil},
+		{"SRS0=8Zzm=IS=netmark.rs=milos@domain.com", "SRS0=8Zzm=IS=netmark.rs=milos", "domain.com", nil},
+		{"SRS1+50B9=domain.net=-8Zzm=IS=netmark.rs=milos@domain.com", "SRS1+50B9=domain.net=-8Zzm=IS=netmark.rs=milos", "domain.com", nil},
+		{"asdijaoisjd asidj oaisjd", "", "", ErrNoAtSign},
+		{"milos@", "", "", ErrBadFormat},
+		{"@domain.com", "", "", ErrBadFormat},
+		{"milos@netmark.rs@domain.com", "", "", ErrBadFormat},
+		{"milosmileusnic@domain,net", "", "", ErrBadFormat},
+		{"milos mileusnic@domain.net", "", "", ErrBadFormat},
+		{"milos..mileusnic@domain.net", "", "", ErrBadFormat},
+		{".milos@domain.net", "", "", ErrBadFormat},
+		{"milos@domain.net.", "", "", ErrBadFormat},
+	} {
+		user, domain, err := parseEmail(tc.email)
+		if user != tc.user || domain != tc.domain || err != tc.err {
+			t.Errorf("parseEmail %q: expected %q %q %v, got %q %q %v", tc.email, tc.user, tc.domain, tc.err, user, domain, err)
+		}
+	}
+}
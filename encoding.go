@@ -0,0 +1,35 @@
+package srs
+
+// HashEncoding of hash field
+type HashEncoding int
+
+// Hash encodings, Forward uses HashBase64 like other SRS implementations
+const (
+	HashBase64 HashEncoding = iota // 6 bits per character
+	HashBase32                     // 5 bits per character
+	HashHex                        // 4 bits per character
+)
+
+// bitsPerChar returns number of hash bits encoded in one character
+func (e HashEncoding) bitsPerChar() int {
+	switch e {
+	case HashBase64:
+		return 6
+	case HashBase32:
+		return 5
+	case HashHex:
+		return 4
+	}
+	return 0
+}
+
+// CollisionBits returns number of bits of hash truncated to hashLength
+// characters of encoding, like 24 bits for 4 base64 characters. Forged address
+// is accepted with probability 2^-bits per attempt. Hash field is compared case
+// insensitive, so base64 hash is effectively a bit weaker than returned.
+func CollisionBits(hashLength int, encoding HashEncoding) int {
+	if hashLength < 0 {
+		return 0
+	}
+	return hashLength * encoding.bitsPerChar()
+}
@@ -0,0 +1,31 @@
+package srs_test
+
+import (
+	"testing"
+
+	"github.com/mileusna/srs"
+)
+
+func TestCollisionBits(t *testing.T) {
+	for _, tc := range []struct {
+		length   int
+		encoding srs.HashEncoding
+		bits     int
+	}{
+		{4, srs.HashBase64, 24},
+		{6, srs.HashBase64, 36},
+		{8, srs.HashBase64, 48},
+		{4, srs.HashBase32, 20},
+		{6, srs.HashBase32, 30},
+		{8, srs.HashBase32, 40},
+		{4, srs.HashHex, 16},
+		{6, srs.HashHex, 24},
+		{8, srs.HashHex, 32},
+		{-1, srs.HashBase64, 0},
+		{4, srs.HashEncoding(42), 0},
+	} {
+		if bits := srs.CollisionBits(tc.length, tc.encoding); bits != tc.bits {
+			t.Errorf("CollisionBits %d %d: expected %d, got %d", tc.length, tc.encoding, tc.bits, bits)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package srs
+
+import "strings"
+
+// isDotAtom reports whether s is dot-atom as defined in RFC 5322
+func isDotAtom(s string) bool {
+	if s == "" || s[0] == '.' || s[len(s)-1] == '.' || strings.Contains(s, "..") {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '.' && c < 0x80 && !strings.ContainsRune(atext, rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// atext characters allowed in dot-atom besides UTF-8
+const atext = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!#$%&'*+-/=?^_`{|}~"
+
+// isPlausibleDomain reports whether s looks like domain name with at least
+// two labels of letters, digits and hyphens, UTF-8 is allowed for IDN
+func isPlausibleDomain(s string) bool {
+	labels := strings.Split(s, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c >= 0x80) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// plausibleFields reports whether host and user of SRS0 address look like
+// domain and dot-atom local part
+func plausibleFields(host, user string) bool {
+	return isPlausibleDomain(host) && isDotAtom(user)
+}
+
+// isSMTPSafe reports whether address can be written to SMTP command or
+// header as is, without space, control characters or angle brackets
+func isSMTPSafe(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c <= ' ' || c == 0x7f || c == '<' || c == '>' {
+			return false
+		}
+	}
+	return true
+}
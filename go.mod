@@ -1,3 +1,8 @@
 module github.com/mileusna/srs
 
-go 1.15
+go 1.17
+
+require (
+	golang.org/x/net v0.17.0
+	golang.org/x/text v0.13.0
+)
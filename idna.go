@@ -0,0 +1,61 @@
+//go:build !srs_nomail
+// +build !srs_nomail
+
+package srs
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// acePrefix of punycode encoded labels
+const acePrefix = "xn--"
+
+// toASCII returns domain with non-ASCII labels mapped by UTS #46 and punycode
+// encoded with xn-- prefix. ASCII domain is returned as is.
+func toASCII(domain string) (string, error) {
+	if isASCII(domain) {
+		return domain, nil
+	}
+	return idna.Lookup.ToASCII(domain)
+}
+
+// toUnicode returns domain with xn-- labels decoded, labels which can't be
+// decoded or are not in canonical form are kept in ACE form and reported with
+// ok false. ACE labels are case-insensitive, so they are lower-cased first,
+// XN--MLLER-KVA is müller.
+func toUnicode(domain string) (unicode string, ok bool) {
+	ok = true
+	labels := strings.Split(domain, ".")
+	for i, label := range labels {
+		if len(label) < len(acePrefix) || !strings.EqualFold(label[:len(acePrefix)], acePrefix) {
+			continue
+		}
+		label = strings.ToLower(label)
+		labels[i] = label
+		decoded, err := idna.Lookup.ToUnicode(label)
+		if err != nil {
+			ok = false
+			continue
+		}
+		// decoded label must encode back to the same label
+		if ace, err := idna.Lookup.ToASCII(decoded); err != nil || ace != label {
+			ok = false
+			continue
+		}
+		labels[i] = decoded
+	}
+	return strings.Join(labels, "."), ok
+}
+
+// isASCII reports whether s contains only ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
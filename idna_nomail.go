@@ -0,0 +1,14 @@
+//go:build srs_nomail
+// +build srs_nomail
+
+package srs
+
+// toASCII returns domain as is, IDNA is rejected by setDefaults in lean build
+func toASCII(domain string) (string, error) {
+	return domain, nil
+}
+
+// toUnicode returns domain as is, IDNA is rejected by setDefaults in lean build
+func toUnicode(domain string) (unicode string, ok bool) {
+	return domain, true
+}
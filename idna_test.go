@@ -0,0 +1,137 @@
+//go:build !srs_nomail
+// +build !srs_nomail
+
+package srs_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mileusna/srs"
+)
+
+func TestIDNA(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+		IDNA:   true,
+	}
+
+	for _, tc := range []struct {
+		email string
+		ace   string
+	}{
+		{"u@müller.de", "xn--mller-kva.de"},
+		{"u@münchen.de", "xn--mnchen-3ya.de"},
+		{"u@bücher.example.com", "xn--bcher-kva.example.com"},
+		{"u@例え.テスト", "xn--r8jz45g.xn--zckzah"},
+		{"u@правительство.рф", "xn--80aealotwbjpid2k.xn--p1ai"},
+		{"u@mailspot.com", "mailspot.com"},
+	} {
+		fwd, err := s.Forward(tc.email)
+		if err != nil {
+			t.Errorf("Forward %s: %v", tc.email, err)
+			continue
+		}
+		if !strings.Contains(fwd, "="+tc.ace+"=") {
+			t.Errorf("Forward %s: expected host %s, got %s", tc.email, tc.ace, fwd)
+		}
+
+		rvs, err := s.Reverse(fwd)
+		if err != nil || rvs != tc.email {
+			t.Errorf("Reverse %s: expected %s, got %s %v", fwd, tc.email, rvs, err)
+		}
+
+		rvs, ace, err := s.ReverseUnicode(fwd)
+		if err != nil || ace || rvs != tc.email {
+			t.Errorf("ReverseUnicode %s: expected %s false, got %s %v %v", fwd, tc.email, rvs, ace, err)
+		}
+	}
+
+	// undecodable ACE label is returned as is and flagged
+	fwd, err := s.Forward("u@xn--99999999999.de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rvs, ace, err := s.ReverseUnicode(fwd)
+	if err != nil || !ace || rvs != "u@xn--99999999999.de" {
+		t.Errorf("ReverseUnicode %s: expected u@xn--99999999999.de true, got %s %v %v", fwd, rvs, ace, err)
+	}
+	if rvs, err := s.Reverse(fwd); err != nil || rvs != "u@xn--99999999999.de" {
+		t.Errorf("Reverse %s: expected u@xn--99999999999.de, got %s %v", fwd, rvs, err)
+	}
+}
+
+func TestIDNAMapping(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+		IDNA:   true,
+	}
+
+	// UTS #46 mapping, like other IDNA implementations
+	for _, tc := range []struct {
+		email    string
+		ace      string
+		expected string
+	}{
+		{"u@straße.de", "xn--strae-oqa.de", "u@straße.de"},
+		{"u@MÜLLER.de", "xn--mller-kva.de", "u@müller.de"},
+		{"u@ｍüller.de", "xn--mller-kva.de", "u@müller.de"},
+	} {
+		fwd, err := s.Forward(tc.email)
+		if err != nil {
+			t.Errorf("Forward %s: %v", tc.email, err)
+			continue
+		}
+		if !strings.Contains(fwd, "="+tc.ace+"=") {
+			t.Errorf("Forward %s: expected host %s, got %s", tc.email, tc.ace, fwd)
+		}
+		if rvs, err := s.Reverse(fwd); err != nil || rvs != tc.expected {
+			t.Errorf("Reverse %s: expected %s, got %s %v", fwd, tc.expected, rvs, err)
+		}
+	}
+
+	// ACE label which is not in canonical form is not decoded
+	fwd, err := s.Forward("u@xn--abc-.de")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rvs, ace, err := s.ReverseUnicode(fwd); err != nil || !ace || rvs != "u@xn--abc-.de" {
+		t.Errorf("ReverseUnicode %s: expected u@xn--abc-.de true, got %s %v %v", fwd, rvs, ace, err)
+	}
+}
+
+func TestIDNAUppercaseACE(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+		IDNA:   true,
+	}
+	lower, err := s.Forward("u@xn--mller-kva.de")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		email    string
+		expected string
+	}{
+		{"u@xn--mller-kva.de", "u@müller.de"},
+		{"u@XN--MLLER-KVA.DE", "u@müller.DE"},
+		{"u@Xn--Mller-Kva.de", "u@müller.de"},
+		{"u@XN--99999999999.DE", "u@xn--99999999999.DE"},
+	} {
+		fwd, err := s.Forward(tc.email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rvs, err := s.Reverse(fwd); err != nil || rvs != tc.expected {
+			t.Errorf("Reverse %s: expected %s, got %s %v", fwd, tc.expected, rvs, err)
+		}
+		// hash input is lower-cased, so hash doesn't depend on ACE case
+		if strings.Contains(tc.email, "MLLER") && fwd[:9] != lower[:9] {
+			t.Errorf("Forward %s: expected hash of %s, got %s", tc.email, lower, fwd)
+		}
+	}
+}
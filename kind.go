@@ -0,0 +1,86 @@
+package srs
+
+import "strings"
+
+// Kind of email address
+type Kind int
+
+// Kinds of email addresses returned by Kind
+const (
+	KindInvalid Kind = iota // malformed email address
+	KindPlain               // valid address which is not SRS address
+	KindSRS0                // SRS0 address
+	KindSRS1                // SRS1 address
+)
+
+// Kind returns kind of email address detected by SRS prefix of local part.
+// Only prefix is checked, so SRS address with malformed fields is still
+// reported as SRS0 or SRS1 and rejected by Reverse later.
+func (srs *SRS) Kind(email string) Kind {
+	srs.setDefaults()
+	local, _, err := parseEmail(email)
+	if err != nil {
+		return KindInvalid
+	}
+	return srs.kind(local)
+}
+
+// Depth returns number of SRS layers of email address without hash validation,
+// 0 for plain address, 1 for SRS0 and 2 for SRS1 which wraps SRS0. Addresses
+// nested by broken upstream forwarders, like SRS0 of SRS0, count every layer.
+func (srs *SRS) Depth(email string) (int, error) {
+	if err := srs.setDefaults(); err != nil {
+		return 0, err
+	}
+
+	local, _, err := parseEmail(email)
+	if err != nil {
+		return 0, err
+	}
+	if i := strings.LastIndex(local, sep); srs.FullChecksum && srs.kind(local) != KindPlain && i != -1 {
+		local = local[:i]
+	}
+
+	depth := 0
+	for {
+		var srsUser string
+		layers := 1
+		switch srs.kind(local) {
+		case KindSRS0:
+			_, _, _, _, srsUser, err = srs.parseSRS0(local)
+
+		case KindSRS1:
+			_, _, _, _, _, _, srsUser, err = srs.parseSRS1(local)
+			layers = 2
+
+		default:
+			return depth, nil
+		}
+
+		if err != nil {
+			if depth == 0 {
+				return 0, err
+			}
+			// inner layer is not SRS address after all
+			return depth, nil
+		}
+		depth += layers
+		if srsUser == "" {
+			// opaque SRS0 data of foreign SRS1
+			return depth, nil
+		}
+		local = srsUser
+	}
+}
+
+// kind returns kind of local part by SRS prefix
+func (srs SRS) kind(local string) Kind {
+	switch {
+	case hasPrefix(local, srs.Prefixes.SRS0):
+		return KindSRS0
+	case hasPrefix(local, srs.Prefixes.SRS1):
+		return KindSRS1
+	default:
+		return KindPlain
+	}
+}
@@ -0,0 +1,58 @@
+package srs_test
+
+import (
+	"testing"
+
+	"github.com/mileusna/srs"
+)
+
+func TestKind(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	for _, tc := range []struct {
+		email    string
+		expected srs.Kind
+	}{
+		{"milos@mailspot.com", srs.KindPlain},
+		{"SRS0@mailspot.com", srs.KindPlain},
+		{"SRS0=8Zzm=IS=netmark.rs=milos@domain.com", srs.KindSRS0},
+		{"SRS0+8Zzm=IS=netmark.rs=milos@domain.com", srs.KindSRS0},
+		{"SRS1=50B9=domain.com==8Zzm=IS=netmark.rs=milos@" + localdomain, srs.KindSRS1},
+		{"SRS1=wtfisthis=milos@domain.com", srs.KindSRS1},
+		{"asdijaoisjd asidj oaisjd", srs.KindInvalid},
+		{"milos@", srs.KindInvalid},
+	} {
+		if kind := s.Kind(tc.email); kind != tc.expected {
+			t.Errorf("Kind %s: expected %d, got %d", tc.email, tc.expected, kind)
+		}
+	}
+}
+
+func TestDepth(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	for _, tc := range []struct {
+		email string
+		depth int
+		err   error
+	}{
+		{"milos@mailspot.com", 0, nil},
+		{"SRS0@mailspot.com", 0, nil},
+		{"SRS0=8Zzm=IS=netmark.rs=milos@domain.com", 1, nil},
+		{"SRS1=50B9=domain.com==8Zzm=IS=netmark.rs=milos@" + localdomain, 2, nil},
+		{"SRS1=JIBX=thirddomain.com==opaque+string@" + localdomain, 2, nil},
+		{"SRS0=XXXX=IS=domain.com=SRS0=8Zzm=IS=netmark.rs=milos@" + localdomain, 2, nil},
+		{"SRS1=XXXX=fwd.com==YYYY=IS=domain.com=SRS0=8Zzm=IS=netmark.rs=milos@" + localdomain, 3, nil},
+		{"SRS0=XXXX=IS=domain.com=SRS0=opaque@" + localdomain, 1, nil},
+		{"SRS0=8Zzm@domain.com", 0, srs.ErrNoUserSRS0},
+		{"milos", 0, srs.ErrNoAtSign},
+	} {
+		if depth, err := s.Depth(tc.email); depth != tc.depth || err != tc.err {
+			t.Errorf("Depth %s: expected %d %v, got %d %v", tc.email, tc.depth, tc.err, depth, err)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package srs
+
+import "errors"
+
+// FieldLayout is order of hash and timestamp fields of SRS0 address
+type FieldLayout int
+
+// Field layouts of SRS0 address
+const (
+	LayoutStandard       FieldLayout = iota // SRS0=hash=ts=host=user
+	LayoutTimestampFirst                    // SRS0=ts=hash=host=user of some commercial MTAs
+)
+
+// ErrFieldLayoutConfig is returned for unknown FieldLayout
+var ErrFieldLayoutConfig = errors.New("FieldLayout unknown")
+
+// order returns hash and timestamp fields in order of layout, or hash and
+// timestamp from first two fields of SRS0 address, since swap is symmetric
+func (l FieldLayout) order(a, b string) (string, string) {
+	if l == LayoutTimestampFirst {
+		return b, a
+	}
+	return a, b
+}
@@ -0,0 +1,68 @@
+package srs_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mileusna/srs"
+)
+
+func TestFieldLayout(t *testing.T) {
+	standard := srs.SRS{Secret: []byte(secret), Domain: localdomain}
+	vendor := srs.SRS{Secret: []byte(secret), Domain: localdomain, FieldLayout: srs.LayoutTimestampFirst}
+
+	fwdStandard, err := standard.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fwdVendor, err := vendor.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same hash and timestamp in swapped order
+	s := strings.Split(fwdStandard, "=")
+	v := strings.Split(fwdVendor, "=")
+	if len(v[1]) != 2 || v[1] != s[2] || v[2] != s[1] || v[3] != s[3] {
+		t.Errorf("Forward with LayoutTimestampFirst: expected ts before hash of %s, got %s", fwdStandard, fwdVendor)
+	}
+
+	a, err := vendor.Parse(fwdVendor)
+	if err != nil || a.Hash != v[2] || a.Timestamp != v[1] {
+		t.Errorf("Parse %s: expected hash %s timestamp %s, got %+v %v", fwdVendor, v[2], v[1], a, err)
+	}
+
+	for _, tc := range []struct {
+		engine srs.SRS
+		fwd    string
+	}{
+		{standard, fwdStandard},
+		{vendor, fwdVendor},
+	} {
+		if rvs, err := tc.engine.Reverse(tc.fwd); rvs != "milos@mailspot.com" || err != nil {
+			t.Errorf("Reverse %s: expected milos@mailspot.com, got %s %v", tc.fwd, rvs, err)
+		}
+
+		// SRS1 round trip keeps the layout of inner SRS0
+		srs1, err := tc.engine.Forward(strings.Replace(tc.fwd, localdomain, "domain.com", 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rvs, err := tc.engine.Reverse(srs1); rvs != strings.Replace(tc.fwd, localdomain, "domain.com", 1) || err != nil {
+			t.Errorf("Reverse %s: got %s %v", srs1, rvs, err)
+		}
+	}
+
+	// addresses of other layout are rejected
+	if rvs, err := vendor.Reverse(fwdStandard); err == nil {
+		t.Errorf("Reverse %s with LayoutTimestampFirst: expected error, got %s", fwdStandard, rvs)
+	}
+	if rvs, err := standard.Reverse(fwdVendor); err == nil {
+		t.Errorf("Reverse %s with LayoutStandard: expected error, got %s", fwdVendor, rvs)
+	}
+
+	bad := srs.SRS{Secret: []byte(secret), Domain: localdomain, FieldLayout: 2}
+	if err := bad.Validate(); err != srs.ErrFieldLayoutConfig {
+		t.Errorf("Validate: expected %v, got %v", srs.ErrFieldLayoutConfig, err)
+	}
+}
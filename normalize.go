@@ -0,0 +1,14 @@
+//go:build !srs_nomail
+// +build !srs_nomail
+
+package srs
+
+import "golang.org/x/text/unicode/norm"
+
+// unicodeSupported reports whether build includes Unicode tables
+const unicodeSupported = true
+
+// nfc returns s in Unicode NFC form
+func nfc(s string) string {
+	return norm.NFC.String(s)
+}
@@ -0,0 +1,13 @@
+//go:build srs_nomail
+// +build srs_nomail
+
+package srs
+
+// unicodeSupported reports whether build includes Unicode tables, lean build
+// doesn't link golang.org/x/text
+const unicodeSupported = false
+
+// nfc returns s unchanged, NormalizeUnicode is rejected by setDefaults
+func nfc(s string) string {
+	return s
+}
@@ -0,0 +1,21 @@
+//go:build srs_nomail
+// +build srs_nomail
+
+package srs_test
+
+import (
+	"testing"
+
+	"github.com/mileusna/srs"
+)
+
+func TestNormalizeUnicodeNoMail(t *testing.T) {
+	for _, s := range []srs.SRS{
+		{Secret: []byte(secret), Domain: localdomain, NormalizeUnicode: true},
+		{Secret: []byte(secret), Domain: localdomain, IDNA: true},
+	} {
+		if err := s.Validate(); err != srs.ErrUnicodeConfig {
+			t.Errorf("Validate: expected %v, got %v", srs.ErrUnicodeConfig, err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+//go:build !srs_nomail
+// +build !srs_nomail
+
+package srs_test
+
+import (
+	"testing"
+
+	"github.com/mileusna/srs"
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestNormalizeUnicode(t *testing.T) {
+	nfc := "milos@caf\u00e9.com"
+	nfd := "milos@cafe\u0301.com"
+
+	for _, normalize := range []bool{false, true} {
+		s := srs.SRS{
+			Secret:           []byte(secret),
+			Domain:           localdomain,
+			NormalizeUnicode: normalize,
+		}
+		fwdNFC, err := s.Forward(nfc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fwdNFD, err := s.Forward(nfd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if same := fwdNFC == fwdNFD; same != normalize {
+			t.Errorf("Forward with NormalizeUnicode %v: expected same addresses %v, got %s and %s", normalize, normalize, fwdNFC, fwdNFD)
+		}
+
+		// reverse of address which was renormalized in transit
+		if rvs, err := s.Reverse(norm.NFD.String(fwdNFC)); normalize && (err != nil || rvs != nfc) {
+			t.Errorf("Reverse NFD form of %s: expected %s, got %s %v", fwdNFC, nfc, rvs, err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package srs
+
+import "strings"
+
+// Address is SRS address split to fields. Fields are not validated, so hash
+// and timestamp of parsed address may be invalid or expired.
+type Address struct {
+	Kind      Kind     // KindSRS0 or KindSRS1
+	Separator string   // separator after SRS0 or SRS1 prefix
+	Hash      string   // hash field
+	Timestamp string   // timestamp field of SRS0
+	Host      string   // original domain of SRS0, previous forwarder of SRS1
+	User      string   // original local part of SRS0
+	Opaque    string   // SRS0 data which is not split to fields, like opaque+string
+	Domain    string   // domain of the address
+	Inner     *Address // SRS0 address embedded in SRS1, nil for SRS0
+}
+
+// Parse SRS address to fields without hash and timestamp validation, returns
+// ErrNotSRS for address which is not SRS address. SRS0 address embedded in
+// SRS1 is returned in Inner, with Opaque data if it can't be split to fields.
+func (srs *SRS) Parse(email string) (*Address, error) {
+	if err := srs.setDefaults(); err != nil {
+		return nil, err
+	}
+
+	local, host, err := parseEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
+	switch srs.kind(local) {
+	case KindSRS0:
+		_, hash, ts, srsHost, srsUser, err := srs.parseSRS0(local)
+		if err != nil {
+			return nil, err
+		}
+		return &Address{
+			Kind:      KindSRS0,
+			Separator: local[srs.srs0Len-firstSepLen : srs.srs0Len],
+			Hash:      hash,
+			Timestamp: ts,
+			Host:      srsHost,
+			User:      srsUser,
+			Domain:    host,
+		}, nil
+
+	case KindSRS1:
+		srsLocal, srs1Hash, srs1Host, srsHash, srsTimestamp, srsHost, srsUser, err := srs.parseSRS1(local)
+		if err != nil {
+			return nil, err
+		}
+		inner := &Address{
+			Kind:      KindSRS0,
+			Separator: srsLocal[:firstSepLen],
+			Hash:      srsHash,
+			Timestamp: srsTimestamp,
+			Host:      srsHost,
+			User:      srsUser,
+			Domain:    srs1Host,
+		}
+		if srsUser == "" {
+			inner.Opaque = srsLocal[firstSepLen:]
+		}
+		return &Address{
+			Kind:      KindSRS1,
+			Separator: local[srs.srs1Len-firstSepLen : srs.srs1Len],
+			Hash:      srs1Hash,
+			Host:      srs1Host,
+			Domain:    host,
+			Inner:     inner,
+		}, nil
+
+	default:
+		return nil, ErrNotSRS
+	}
+}
+
+// SplitSRS splits SRS address to local part and forwarding domain at the last
+// at sign, since local part may contain at sign of quoted original local part.
+// Quoted local part, like "SRS0=hash=ts=host=a@b"@domain, is unquoted.
+func SplitSRS(email string) (local, domain string, err error) {
+	at := strings.LastIndex(email, "@")
+	if at == -1 {
+		return "", "", ErrNoAtSign
+	}
+	local, domain = email[:at], email[at+1:]
+	if len(local) >= 2 && local[0] == '"' && local[len(local)-1] == '"' {
+		local = unquote(local[1 : len(local)-1])
+	}
+	if local == "" || domain == "" {
+		return "", "", ErrBadFormat
+	}
+	return local, domain, nil
+}
+
+// unquote removes backslash escapes of quoted string content
+func unquote(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,107 @@
+package srs_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mileusna/srs"
+)
+
+func TestParse(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte("tops3cr3t"),
+		Domain: "example.com",
+	}
+
+	for _, tc := range []struct {
+		email    string
+		expected *srs.Address
+		err      error
+	}{
+		{
+			"SRS0=vmyz=2W=otherdomain.com=test@example.com",
+			&srs.Address{Kind: srs.KindSRS0, Separator: "=", Hash: "vmyz", Timestamp: "2W", Host: "otherdomain.com", User: "test", Domain: "example.com"},
+			nil,
+		},
+		{
+			"SRS1=JIBX=thirddomain.com==opaque+string@example.com",
+			&srs.Address{
+				Kind: srs.KindSRS1, Separator: "=", Hash: "JIBX", Host: "thirddomain.com", Domain: "example.com",
+				Inner: &srs.Address{Kind: srs.KindSRS0, Separator: "=", Opaque: "opaque+string", Domain: "thirddomain.com"},
+			},
+			nil,
+		},
+		{
+			"SRS1+Qlji=thirddomain.com=+vmyz=2W=otherdomain.com=test@example.com",
+			&srs.Address{
+				Kind: srs.KindSRS1, Separator: "+", Hash: "Qlji", Host: "thirddomain.com", Domain: "example.com",
+				Inner: &srs.Address{Kind: srs.KindSRS0, Separator: "+", Hash: "vmyz", Timestamp: "2W", Host: "otherdomain.com", User: "test", Domain: "thirddomain.com"},
+			},
+			nil,
+		},
+		{"test@example.com", nil, srs.ErrNotSRS},
+		{"SRS0=vmyz=2W@example.com", nil, srs.ErrNoUserSRS0},
+	} {
+		addr, err := s.Parse(tc.email)
+		if err != tc.err || !reflect.DeepEqual(addr, tc.expected) {
+			t.Errorf("Parse %s: expected %+v %v, got %+v %v", tc.email, tc.expected, tc.err, addr, err)
+			if addr != nil && tc.expected != nil {
+				t.Errorf("inner: expected %+v, got %+v", tc.expected.Inner, addr.Inner)
+			}
+		}
+	}
+}
+
+func TestSplitSRS(t *testing.T) {
+	for _, tc := range []struct {
+		email  string
+		local  string
+		domain string
+		err    error
+	}{
+		{"SRS0=8Zzm=IS=netmark.rs=milos@domain.com", "SRS0=8Zzm=IS=netmark.rs=milos", "domain.com", nil},
+		{"SRS1=XXXX=domain.com==8Zzm=IS=netmark.rs=milos@" + localdomain, "SRS1=XXXX=domain.com==8Zzm=IS=netmark.rs=milos", localdomain, nil},
+		{"SRS0=8Zzm=IS=netmark.rs=a@b@domain.com", "SRS0=8Zzm=IS=netmark.rs=a@b", "domain.com", nil},
+		{`"SRS0=8Zzm=IS=netmark.rs=a@b"@domain.com`, "SRS0=8Zzm=IS=netmark.rs=a@b", "domain.com", nil},
+		{`"SRS0=8Zzm=IS=netmark.rs=a\"b"@domain.com`, `SRS0=8Zzm=IS=netmark.rs=a"b`, "domain.com", nil},
+		{"SRS0=8Zzm=IS=netmark.rs=milos", "", "", srs.ErrNoAtSign},
+		{"SRS0=8Zzm=IS=netmark.rs=milos@", "", "", srs.ErrBadFormat},
+		{"@domain.com", "", "", srs.ErrBadFormat},
+	} {
+		local, domain, err := srs.SplitSRS(tc.email)
+		if local != tc.local || domain != tc.domain || err != tc.err {
+			t.Errorf("SplitSRS %s: expected %q %q %v, got %q %q %v", tc.email, tc.local, tc.domain, tc.err, local, domain, err)
+		}
+	}
+}
+
+func TestParseMixedSeparators(t *testing.T) {
+	for _, tc := range []struct {
+		email string
+		hash  string
+		ts    string
+		host  string
+		user  string
+	}{
+		{"SRS0=vmyz+2W=otherdomain.com+test@example.com", "vmyz", "2W", "otherdomain.com", "test"},
+		{"SRS0=vmyz-2W-other-domain.com=test-user@example.com", "vmyz", "2W", "other-domain.com", "test-user"},
+		{"SRS0=vm+z=2W+otherdomain.com=test+tag@example.com", "vm+z", "2W", "otherdomain.com", "test+tag"},
+		{"SRS0+vmyz=2W+otherdomain.com=test@example.com", "vmyz", "2W", "otherdomain.com", "test"},
+	} {
+		lenient := srs.SRS{Secret: []byte("tops3cr3t"), Domain: "example.com", Lenient: true}
+		a, err := lenient.Parse(tc.email)
+		if err != nil {
+			t.Errorf("Parse %s: %v", tc.email, err)
+			continue
+		}
+		if a.Hash != tc.hash || a.Timestamp != tc.ts || a.Host != tc.host || a.User != tc.user {
+			t.Errorf("Parse %s: expected %s %s %s %s, got %+v", tc.email, tc.hash, tc.ts, tc.host, tc.user, a)
+		}
+
+		// strict mode requires = between fields
+		strict := srs.SRS{Secret: []byte("tops3cr3t"), Domain: "example.com"}
+		if a, err := strict.Parse(tc.email); err != srs.ErrNoUserSRS0 {
+			t.Errorf("Parse %s in strict mode: expected %v, got %+v %v", tc.email, srs.ErrNoUserSRS0, a, err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package srs
+
+import "strings"
+
+// PostfixConfig returns template of Postfix main.cf lines for socketmap daemon
+// at socketPath which serves forward and reverse maps with Forward and Reverse
+// of the engine, map names used by postsrsd 2. This package doesn't provide
+// the daemon, it must be run separately. Path without type like
+// /var/spool/postfix/srs is unix socket, inet:host:port is used as is.
+// Configuration error is returned like by Validate.
+func (srs *SRS) PostfixConfig(socketPath string) (string, error) {
+	if err := srs.setDefaults(); err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(socketPath, "unix:") && !strings.HasPrefix(socketPath, "inet:") {
+		socketPath = "unix:" + socketPath
+	}
+	domains := append([]string{srs.Domain}, srs.AltDomains...)
+
+	var b strings.Builder
+	b.WriteString("# template for socketmap daemon serving forward and reverse maps, like postsrsd 2\n")
+	b.WriteString("# SRS forwarding domain " + strings.Join(domains, ", ") + "\n")
+	b.WriteString("# reverse rewrites addresses starting with " + strings.Join(srs.AcceptedPrefixes(), " ") + "\n")
+	b.WriteString("sender_canonical_maps = socketmap:" + socketPath + ":forward\n")
+	b.WriteString("sender_canonical_classes = envelope_sender\n")
+	b.WriteString("recipient_canonical_maps = socketmap:" + socketPath + ":reverse\n")
+	b.WriteString("recipient_canonical_classes = envelope_recipient, header_recipient\n")
+	return b.String(), nil
+}
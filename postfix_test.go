@@ -0,0 +1,45 @@
+package srs_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mileusna/srs"
+)
+
+func TestPostfixConfig(t *testing.T) {
+	s := srs.SRS{
+		Secret:   []byte(secret),
+		Domain:   localdomain,
+		Prefixes: srs.Prefixes{SRS0: "SRS2", SRS1: "SRS3"},
+	}
+
+	for _, tc := range []struct {
+		path string
+		maps string
+	}{
+		{"/var/spool/postfix/srs", "socketmap:unix:/var/spool/postfix/srs:"},
+		{"unix:/run/srs.sock", "socketmap:unix:/run/srs.sock:"},
+		{"inet:127.0.0.1:10003", "socketmap:inet:127.0.0.1:10003:"},
+	} {
+		conf, err := s.PostfixConfig(tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{
+			localdomain,
+			"SRS2= SRS2+ SRS2- SRS3= SRS3+ SRS3-",
+			"sender_canonical_maps = " + tc.maps + "forward\n",
+			"recipient_canonical_maps = " + tc.maps + "reverse\n",
+		} {
+			if !strings.Contains(conf, expected) {
+				t.Errorf("PostfixConfig %s: expected %q in\n%s", tc.path, expected, conf)
+			}
+		}
+	}
+
+	bad := srs.SRS{Secret: []byte(secret), Domain: localdomain, HashLength: 2}
+	if conf, err := bad.PostfixConfig("/var/spool/postfix/srs"); conf != "" || err != srs.ErrHashTooShortConfig {
+		t.Errorf("PostfixConfig: expected %v, got %q %v", srs.ErrHashTooShortConfig, conf, err)
+	}
+}
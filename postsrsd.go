@@ -0,0 +1,26 @@
+package srs
+
+// postsrsdMessages are messages of package errors as returned by postsrsd
+var postsrsdMessages = map[error]string{
+	ErrNoAtSign:               "No at sign in sender address",
+	ErrNotSRS:                 "Not an SRS address.",
+	ErrNoUserSRS0:             "No user in SRS0 address.",
+	ErrNoUserSRS1:             "No user in SRS1 address.",
+	ErrHashTooShort:           "Hash too short in SRS address.",
+	ErrHashInvalid:            "Hash invalid in SRS address.",
+	ErrTimestampInvalidBase32: "Bad base32 character in timestamp.",
+	ErrTimestampExpired:       "Time stamp out of date.",
+}
+
+// PostSRSdMessage returns error message as returned by postsrsd, for servers
+// which replace postsrsd and shouldn't break existing log monitoring. Errors
+// without postsrsd equivalent are returned as is.
+func PostSRSdMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	if msg, ok := postsrsdMessages[err]; ok {
+		return msg
+	}
+	return err.Error()
+}
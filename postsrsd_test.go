@@ -0,0 +1,42 @@
+package srs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mileusna/srs"
+)
+
+func TestPostSRSdMessage(t *testing.T) {
+	s := srs.SRS{
+		Secret:  []byte("tops3cr3t"),
+		Domain:  "example.com",
+		NowFunc: func() time.Time { return time.Date(2020, 1, 1, 0, 1, 0, 0, time.UTC) },
+	}
+
+	for _, tc := range []struct {
+		email    string
+		expected string
+	}{
+		{"test@example.com", "Not an SRS address."},
+		{"SRS0=ABCD=2W=otherdomain.com=test@example.com", "Hash invalid in SRS address."},
+		{"SRS0=ABYE=ZX=otherdomain.com=test@example.com", "Time stamp out of date."},
+		{"SRS0=vmyz=2!=otherdomain.com=test@example.com", "Bad base32 character in timestamp."},
+		{"SRS0=vmyz=2W=otherdomain.com@example.com", "No user in SRS0 address."},
+		{"SRS1=wtfisthis=milos@example.com", "No user in SRS1 address."},
+		{"SRS1===@example.com", "Hash too short in SRS address."},
+		{"SRS0=vmyz=2W=otherdomain.com=test@" + string(make([]byte, 1024)), "Address too long"},
+	} {
+		_, err := s.Reverse(tc.email)
+		if msg := srs.PostSRSdMessage(err); msg != tc.expected {
+			t.Errorf("PostSRSdMessage %s: expected %q, got %q", tc.email, tc.expected, msg)
+		}
+	}
+
+	if msg := srs.PostSRSdMessage(srs.ErrNoAtSign); msg != "No at sign in sender address" {
+		t.Errorf("PostSRSdMessage: unexpected message %q", msg)
+	}
+	if msg := srs.PostSRSdMessage(nil); msg != "" {
+		t.Errorf("PostSRSdMessage nil: expected empty message, got %q", msg)
+	}
+}
@@ -0,0 +1,165 @@
+package srs
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	minSecretLength = 16 // recommended minimum length of Secret in bytes
+	derivedKeyLen   = 32 // length of key derived from MasterSecret
+)
+
+// Secret errors
+var (
+	ErrNoSecret     = errors.New("No secret in secret file") // returned by LoadFromFile when file contains no secrets
+	ErrWeakSecret   = errors.New("Secret too short, minimum is 16 bytes")
+	ErrSecretConfig = errors.New("Secret and MasterSecret can't be used together")
+)
+
+// TimedSecret is secret used for signing from NotBefore until the next timed
+// secret becomes active, and for verification of addresses signed meanwhile
+type TimedSecret struct {
+	Secret    []byte
+	NotBefore time.Time
+}
+
+// primarySecret returns the newest active TimedSecrets secret or Secret
+func (srs SRS) primarySecret() []byte {
+	now := srs.now()
+	var active *TimedSecret
+	for i, timed := range srs.TimedSecrets {
+		if !timed.NotBefore.After(now) && (active == nil || timed.NotBefore.After(active.NotBefore)) {
+			active = &srs.TimedSecrets[i]
+		}
+	}
+	if active == nil {
+		return srs.Secret
+	}
+	return active.Secret
+}
+
+// timedSecretCovers reports whether TimedSecrets[i] was active on the day of
+// timestamp ts, or whether it is activated if ts is empty or invalid
+func (srs SRS) timedSecretCovers(i int, ts string) bool {
+	from := srs.TimedSecrets[i].NotBefore
+	if from.After(srs.now()) {
+		return false
+	}
+	age, err := srs.timestampAge(ts)
+	if ts == "" || err != nil {
+		return true
+	}
+
+	// secret is active until the next timed secret is
+	var until time.Time
+	for _, timed := range srs.TimedSecrets {
+		if timed.NotBefore.After(from) && (until.IsZero() || timed.NotBefore.Before(until)) {
+			until = timed.NotBefore
+		}
+	}
+	dayStart := srs.slotStart().Add(-time.Duration(age) * slotDuration)
+	return from.Before(dayStart.Add(slotDuration)) && (until.IsZero() || until.After(dayStart))
+}
+
+// CheckSecretStrength returns ErrWeakSecret if Secret or any of TimedSecrets
+// is shorter than 16 bytes, which makes hashes easier to forge by brute force.
+// MasterSecret is checked instead of Secret derived from it. Secret may be
+// empty if TimedSecrets are set. Set RequireStrongSecret to enforce it in
+// Validate, Forward and Reverse.
+func (srs *SRS) CheckSecretStrength() error {
+	secret := srs.Secret
+	if len(srs.MasterSecret) > 0 {
+		secret = srs.MasterSecret
+	}
+	if len(secret) < minSecretLength && (len(secret) > 0 || len(srs.TimedSecrets) == 0) {
+		return ErrWeakSecret
+	}
+	for _, timed := range srs.TimedSecrets {
+		if len(timed.Secret) < minSecretLength {
+			return ErrWeakSecret
+		}
+	}
+	return nil
+}
+
+// LoadFromFile returns SRS engine for domain with secrets from postsrsd style
+// secret file, like /etc/postsrsd.secret. File contains one secret per line,
+// first secret is used for signing and others only for verification.
+// Empty lines and lines starting with # are ignored.
+func LoadFromFile(path, domain string) (*SRS, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var secrets [][]byte
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		secrets = append(secrets, []byte(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(secrets) == 0 {
+		return nil, ErrNoSecret
+	}
+
+	return &SRS{
+		Secret:           secrets[0],
+		SecondarySecrets: secrets[1:],
+		Domain:           domain,
+	}, nil
+}
+
+// Resign verifies SRS address against oldSecret only and forwards the original
+// address again with Secret and fresh timestamp, to migrate live addresses
+// after secret rotation. Address which doesn't verify under oldSecret or is
+// expired returns the error Reverse would return.
+func (srs *SRS) Resign(email string, oldSecret []byte) (string, error) {
+	if err := srs.setDefaults(); err != nil {
+		return "", err
+	}
+
+	old := *srs
+	old.Secret = oldSecret
+	old.SecondarySecrets = nil
+	old.TimedSecrets = nil // primary and full checksum secret is then oldSecret
+	old.SecretForDomain = nil
+	old.Lookup = nil
+	orig, _, err := old.reverseAddress(email, 0)
+	if err != nil {
+		return "", err
+	}
+	return srs.Forward(orig)
+}
+
+// hkdfSHA256 derives key of length n from master secret and info, RFC 5869
+// with empty salt
+func hkdfSHA256(master, info []byte, n int) []byte {
+	extract := hmac.New(sha256.New, make([]byte, sha256.Size))
+	extract.Write(master)
+	prk := extract.Sum(nil)
+
+	var key, t []byte
+	for i := byte(1); len(key) < n; i++ {
+		expand := hmac.New(sha256.New, prk)
+		expand.Write(t)
+		expand.Write(info)
+		expand.Write([]byte{i})
+		t = expand.Sum(nil)
+		key = append(key, t...)
+	}
+	return key[:n]
+}
@@ -0,0 +1,340 @@
+package srs_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mileusna/srs"
+)
+
+func TestLoadFromFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "postsrsd.secret")
+	content := "# current secret\n" + secret + "\r\n\n# previous secrets\nold secret 1\nold secret 2\n\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := srs.LoadFromFile(path, localdomain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(s.Secret) != secret || s.Domain != localdomain {
+		t.Errorf("LoadFromFile: unexpected secret %q or domain %q", s.Secret, s.Domain)
+	}
+	if len(s.SecondarySecrets) != 2 || string(s.SecondarySecrets[0]) != "old secret 1" || string(s.SecondarySecrets[1]) != "old secret 2" {
+		t.Errorf("LoadFromFile: unexpected secondary secrets %q", s.SecondarySecrets)
+	}
+
+	// addresses signed with any secret are reversed, new ones are signed with first
+	for _, secret := range []string{secret, "old secret 1", "old secret 2"} {
+		old := srs.SRS{Secret: []byte(secret), Domain: localdomain}
+		fwd, err := old.Forward("milos@mailspot.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rvs, err := s.Reverse(fwd); err != nil || rvs != "milos@mailspot.com" {
+			t.Errorf("Reverse %s: expected milos@mailspot.com, got %s %v", fwd, rvs, err)
+		}
+	}
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srsCli.Reverse(fwd); err != nil {
+		t.Errorf("Reverse %s: expected signature with first secret, got %v", fwd, err)
+	}
+
+	unknown := srs.SRS{Secret: []byte("unknown secret"), Domain: localdomain}
+	fwd, err = unknown.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Reverse(fwd); err != srs.ErrHashInvalid {
+		t.Errorf("Reverse %s: expected %v, got %v", fwd, srs.ErrHashInvalid, err)
+	}
+
+	empty := filepath.Join(dir, "empty.secret")
+	if err := ioutil.WriteFile(empty, []byte("# no secrets\n\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srs.LoadFromFile(empty, localdomain); err != srs.ErrNoSecret {
+		t.Errorf("LoadFromFile: expected %v, got %v", srs.ErrNoSecret, err)
+	}
+	if _, err := srs.LoadFromFile(filepath.Join(dir, "missing"), localdomain); err == nil {
+		t.Error("LoadFromFile: expected error for missing file")
+	}
+}
+
+func TestCheckSecretStrength(t *testing.T) {
+	for _, tc := range []struct {
+		secret string
+		err    error
+	}{
+		{"", srs.ErrWeakSecret},
+		{"test", srs.ErrWeakSecret},
+		{"0123456789abcde", srs.ErrWeakSecret},
+		{"0123456789abcdef", nil},
+		{secret, nil},
+	} {
+		s := srs.SRS{Secret: []byte(tc.secret), Domain: localdomain}
+		if err := s.CheckSecretStrength(); err != tc.err {
+			t.Errorf("CheckSecretStrength %q: expected %v, got %v", tc.secret, tc.err, err)
+		}
+		// only reported unless enforced
+		if err := s.Validate(); err != nil {
+			t.Errorf("Validate %q: expected no error, got %v", tc.secret, err)
+		}
+
+		s = srs.SRS{Secret: []byte(tc.secret), Domain: localdomain, RequireStrongSecret: true}
+		if err := s.Validate(); err != tc.err {
+			t.Errorf("Validate %q with RequireStrongSecret: expected %v, got %v", tc.secret, tc.err, err)
+		}
+		if _, err := s.Forward("milos@mailspot.com"); err != tc.err {
+			t.Errorf("Forward with secret %q: expected %v, got %v", tc.secret, tc.err, err)
+		}
+	}
+
+	// timed secrets are checked, Secret is optional with them
+	strong, weak := []byte("0123456789abcdef"), []byte("weak")
+	for _, tc := range []struct {
+		secret []byte
+		timed  [][]byte
+		err    error
+	}{
+		{nil, [][]byte{strong, strong}, nil},
+		{strong, [][]byte{strong}, nil},
+		{nil, [][]byte{strong, weak}, srs.ErrWeakSecret},
+		{weak, [][]byte{strong}, srs.ErrWeakSecret},
+	} {
+		s := srs.SRS{Secret: tc.secret, Domain: localdomain, RequireStrongSecret: true}
+		for i, timed := range tc.timed {
+			s.TimedSecrets = append(s.TimedSecrets, srs.TimedSecret{Secret: timed, NotBefore: time.Date(2021, time.Month(i+1), 1, 0, 0, 0, 0, time.UTC)})
+		}
+		if err := s.Validate(); err != tc.err {
+			t.Errorf("Validate %q %q with RequireStrongSecret: expected %v, got %v", tc.secret, tc.timed, tc.err, err)
+		}
+	}
+}
+
+func TestSecretIndexFor(t *testing.T) {
+	secrets := []string{secret, "old secret 1", "old secret 2"}
+	s := srs.SRS{
+		Secret:           []byte(secrets[0]),
+		SecondarySecrets: [][]byte{[]byte(secrets[1]), []byte(secrets[2])},
+		Domain:           localdomain,
+	}
+
+	for i, sec := range secrets {
+		signer := srs.SRS{Secret: []byte(sec), Domain: localdomain}
+		for _, email := range []string{"milos@mailspot.com", "SRS0=8Zzm=IS=netmark.rs=milos@domain.com"} {
+			fwd, err := signer.Forward(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if index, err := s.SecretIndexFor(fwd); index != i || err != nil {
+				t.Errorf("SecretIndexFor %s: expected %d, got %d %v", fwd, i, index, err)
+			}
+		}
+	}
+
+	unknown := srs.SRS{Secret: []byte("unknown secret"), Domain: localdomain}
+	fwd, err := unknown.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index, err := s.SecretIndexFor(fwd); index != -1 || err != srs.ErrHashInvalid {
+		t.Errorf("SecretIndexFor %s: expected -1 %v, got %d %v", fwd, srs.ErrHashInvalid, index, err)
+	}
+	if index, err := s.SecretIndexFor("milos@mailspot.com"); index != -1 || err != srs.ErrNotSRS {
+		t.Errorf("SecretIndexFor: expected -1 %v, got %d %v", srs.ErrNotSRS, index, err)
+	}
+}
+
+func TestMasterSecret(t *testing.T) {
+	engine := func(info string) *srs.SRS {
+		return &srs.SRS{
+			MasterSecret: []byte("master secret for all purposes"),
+			Info:         []byte(info),
+			Domain:       localdomain,
+		}
+	}
+
+	for _, tc := range []struct {
+		a, b       string
+		compatible bool
+	}{
+		{"srs", "srs", true},
+		{"srs", "srs v2", false},
+		{"srs", "", false},
+	} {
+		compatible, err := engine(tc.a).CompatibleWith(engine(tc.b))
+		if compatible != tc.compatible || err != nil {
+			t.Errorf("CompatibleWith %q %q: expected %v, got %v %v", tc.a, tc.b, tc.compatible, compatible, err)
+		}
+	}
+
+	// derived key is not the master secret itself
+	direct := &srs.SRS{Secret: []byte("master secret for all purposes"), Domain: localdomain}
+	if compatible, _ := engine("").CompatibleWith(direct); compatible {
+		t.Error("CompatibleWith: expected derived key to differ from master secret")
+	}
+
+	both := engine("srs")
+	both.Secret = []byte(secret)
+	if err := both.Validate(); err != srs.ErrSecretConfig {
+		t.Errorf("Validate: expected %v, got %v", srs.ErrSecretConfig, err)
+	}
+
+	// strength of master secret is checked, not of key derived from it
+	for _, tc := range []struct {
+		master string
+		err    error
+	}{
+		{"x", srs.ErrWeakSecret},
+		{"0123456789abcdef", nil},
+	} {
+		s := srs.SRS{MasterSecret: []byte(tc.master), Domain: localdomain, RequireStrongSecret: true}
+		if err := s.Validate(); err != tc.err {
+			t.Errorf("Validate MasterSecret %q with RequireStrongSecret: expected %v, got %v", tc.master, tc.err, err)
+		}
+	}
+}
+
+func TestResign(t *testing.T) {
+	oldSecret := []byte("old secret")
+	old := srs.SRS{
+		Secret: oldSecret,
+		Domain: localdomain,
+	}
+	s := srs.SRS{
+		Secret:           []byte(secret),
+		SecondarySecrets: [][]byte{oldSecret},
+		Domain:           localdomain,
+	}
+
+	for _, email := range []string{"milos@mailspot.com", "SRS0=8Zzm=IS=netmark.rs=milos@domain.com"} {
+		fwd, err := old.Forward(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resigned, err := s.Resign(fwd, oldSecret)
+		if err != nil {
+			t.Fatalf("Resign %s: %v", fwd, err)
+		}
+		if i, err := s.SecretIndexFor(resigned); i != 0 || err != nil {
+			t.Errorf("Resign %s: expected primary secret, got %d %v", resigned, i, err)
+		}
+		if rvs, err := (&srs.SRS{Secret: []byte(secret), Domain: localdomain}).Reverse(resigned); rvs != email || err != nil {
+			t.Errorf("Reverse %s with new secret: expected %s, got %s %v", resigned, email, rvs, err)
+		}
+		if _, err := old.Reverse(resigned); err != srs.ErrHashInvalid {
+			t.Errorf("Reverse %s with old secret: expected %v, got %v", resigned, srs.ErrHashInvalid, err)
+		}
+
+		// address signed with current secret doesn't verify under old secret
+		if _, err := s.Resign(resigned, oldSecret); err != srs.ErrHashInvalid {
+			t.Errorf("Resign %s: expected %v, got %v", resigned, srs.ErrHashInvalid, err)
+		}
+	}
+
+	// active timed secret is not used instead of old secret
+	for _, checksum := range []bool{false, true} {
+		timed := srs.SRS{
+			Secret:       []byte(secret),
+			TimedSecrets: []srs.TimedSecret{{Secret: []byte("timed secret"), NotBefore: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}},
+			Domain:       localdomain,
+			FullChecksum: checksum,
+		}
+		fwd, err := timed.Forward("milos@mailspot.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resigned, err := timed.Resign(fwd, []byte("unrelated old secret")); err != srs.ErrHashInvalid {
+			t.Errorf("Resign %s with TimedSecrets: expected %v, got %s %v", fwd, srs.ErrHashInvalid, resigned, err)
+		}
+		oldFwd, err := (&srs.SRS{Secret: oldSecret, Domain: localdomain, FullChecksum: checksum}).Forward("milos@mailspot.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := timed.Resign(oldFwd, oldSecret); err != nil {
+			t.Errorf("Resign %s with TimedSecrets: %v", oldFwd, err)
+		}
+	}
+}
+
+func TestTimedSecrets(t *testing.T) {
+	var now time.Time
+	rotation := time.Date(2021, 3, 10, 12, 0, 0, 0, time.UTC)
+	timed := []srs.TimedSecret{
+		{Secret: []byte("secret A"), NotBefore: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Secret: []byte("secret B"), NotBefore: rotation},
+		{Secret: []byte("secret C"), NotBefore: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	s := srs.SRS{
+		Domain:       localdomain,
+		TimedSecrets: timed,
+		NowFunc:      func() time.Time { return now },
+	}
+	// forward at time with single secret
+	mint := func(secret []byte, at time.Time) string {
+		t.Helper()
+		fixed := srs.SRS{Secret: secret, Domain: localdomain, NowFunc: func() time.Time { return at }}
+		fwd, err := fixed.Forward("milos@mailspot.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fwd
+	}
+
+	// Forward signs with the newest active secret
+	for _, tc := range []struct {
+		at     time.Time
+		secret []byte
+	}{
+		{time.Date(2021, 3, 5, 10, 0, 0, 0, time.UTC), timed[0].Secret},
+		{rotation.Add(-time.Minute), timed[0].Secret},
+		{rotation, timed[1].Secret},
+		{time.Date(2021, 3, 12, 10, 0, 0, 0, time.UTC), timed[1].Secret},
+	} {
+		now = tc.at
+		if fwd, err := s.Forward("milos@mailspot.com"); err != nil || fwd != mint(tc.secret, tc.at) {
+			t.Errorf("Forward at %s: expected %s, got %s %v", tc.at, mint(tc.secret, tc.at), fwd, err)
+		}
+	}
+
+	now = time.Date(2021, 3, 12, 10, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		email string
+		index int
+		err   error
+	}{
+		{mint(timed[1].Secret, now), 0, nil},
+		{mint(timed[0].Secret, time.Date(2021, 3, 5, 10, 0, 0, 0, time.UTC)), 1, nil},
+		{mint(timed[0].Secret, rotation.Add(-time.Hour)), 1, nil},
+		{mint(timed[1].Secret, rotation.Add(time.Hour)), 0, nil},
+		// old secret after rotation day and future secret are not valid
+		{mint(timed[0].Secret, now), -1, srs.ErrHashInvalid},
+		{mint(timed[2].Secret, now), -1, srs.ErrHashInvalid},
+	} {
+		if rvs, err := s.Reverse(tc.email); err != tc.err || err == nil && rvs != "milos@mailspot.com" {
+			t.Errorf("Reverse %s: expected %v, got %s %v", tc.email, tc.err, rvs, err)
+		}
+		if i, err := s.SecretIndexFor(tc.email); i != tc.index || err != tc.err {
+			t.Errorf("SecretIndexFor %s: expected %d %v, got %d %v", tc.email, tc.index, tc.err, i, err)
+		}
+	}
+
+	// SRS1 has no timestamp, so all activated secrets are valid
+	now = time.Date(2021, 3, 5, 10, 0, 0, 0, time.UTC)
+	srs1, err := s.Forward("SRS0=8Zzm=IS=netmark.rs=milos@domain.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	if rvs, err := s.Reverse(srs1); err != nil || rvs != "SRS0=8Zzm=IS=netmark.rs=milos@domain.com" {
+		t.Errorf("Reverse %s: unexpected %s %v", srs1, rvs, err)
+	}
+}
@@ -2,39 +2,389 @@ package srs
 
 import (
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha1"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"math"
-	"net/mail"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"unicode"
 )
 
 const (
 	hashLength    = 4
+	minHashLength = 3  // shorter hashes are trivially forgeable
+	maxHashLength = 27 // base64 encoded sha1 without padding
 	sep           = "="
 	timePrecision = float64(60 * 60 * 24)
 	timeSlots     = float64(1024) // dont make mistakes like 2 ^ 10, since in go ^ is not power operator
 	maxAge        = 21
+	maxTsLength   = 2 // base32 characters needed for timeSlots
+	nonceLen      = 4 // base32 characters of nonce appended to timestamp
+	maxInput      = 1024
+	firstSepLen   = 1 // length of first separator after SRS0/SRS1 prefix
 )
 
-// SRS engine
+// Errors returned by Forward, Reverse and Validate
+var (
+	ErrNoAtSign               = errors.New("No at sign in sender address") // compatibility with postsrsd error message
+	ErrBadFormat              = errors.New("Bad formated email address")
+	ErrNotSRS                 = errors.New("Not an SRS address")
+	ErrBadURLEncoding         = errors.New("Bad URL encoded SRS address")
+	ErrNoUserSRS0             = errors.New("No user in SRS0 address")
+	ErrNoUserSRS1             = errors.New("No user in SRS1 address")
+	ErrHashTooShort           = errors.New("Hash too short in SRS address")
+	ErrHashInvalid            = errors.New("Hash invalid in SRS address")
+	ErrTimestampInvalidBase32 = errors.New("Bad base32 character in timestamp")
+	ErrTimestampExpired       = errors.New("Time stamp out of date")
+	ErrHashTooShortConfig     = errors.New("HashLength too short, minimum is 3")
+	ErrHashTooLongConfig      = errors.New("HashLength too long, maximum is 27")
+	ErrSchemeTagConfig        = errors.New("SchemeTag must be letter or digit")
+	ErrMaxAgeConfig           = errors.New("MaxAge too long, must be less than TimeSlots")
+	ErrTimeSlotsConfig        = errors.New("TimeSlots must be between 1 and 1024")
+	ErrInvalidDomain          = errors.New("Domain must not contain at sign or whitespace")
+	ErrUnicodeConfig          = errors.New("NormalizeUnicode and IDNA not supported in srs_nomail build")
+	ErrInvalidNow             = errors.New("NowFunc returned zero time")
+	ErrInputTooLong           = errors.New("Address too long")
+	ErrWrongDomain            = errors.New("SRS address not at forwarding domain")
+	ErrImplausibleFields      = errors.New("Implausible host or user in SRS address")
+	ErrEmptyDomain            = errors.New("No domain in sender address")
+	ErrUnsafeAddress          = errors.New("SRS address not safe for SMTP")
+	ErrSRS1Rejected           = errors.New("SRS1 address rejected")
+	ErrSRS1HashInvalid        = errors.New("SRS1 hash invalid in SRS address")
+	ErrSRS0HashInvalid        = errors.New("Inner SRS0 hash invalid in SRS1 address")
+)
+
+// SRS engine. Engine is safe for concurrent use by multiple goroutines, the
+// first call initializes defaults once, but options must not be changed after
+// the first call.
 type SRS struct {
 	// Secret key, mandatory
 	Secret []byte
+	// MasterSecret is used to derive Secret with HKDF-SHA256 and Info label,
+	// optional alternative to Secret. Derived key is set to Secret on first use,
+	// so engines with different Info labels are not compatible.
+	MasterSecret []byte
+	// Info label of key derived from MasterSecret, optional
+	Info []byte
+	// RequireStrongSecret makes Validate, Forward and Reverse return
+	// ErrWeakSecret for Secret shorter than 16 bytes, optional
+	RequireStrongSecret bool
+	// SecondarySecrets are used only for verification, optional. Use them to
+	// keep accepting addresses signed with previous secrets after rotation.
+	SecondarySecrets [][]byte
 	// Domain is localhost which will forward the emails
 	Domain string
+	// RejectEmptyDomain makes Forward return ErrEmptyDomain for address
+	// without domain like user@, optional. By default it is rewritten with
+	// empty original domain, like postsrsd does.
+	RejectEmptyDomain bool
+	// AltDomains are other forwarding domains of the engine, optional. Like
+	// Domain, addresses at them are never rewritten by Forward.
+	AltDomains []string
+	// LocalDomainSuffix like .example.com makes example.com and all its
+	// subdomains local like Domain, optional
+	LocalDomainSuffix string
+	// StrictReverseDomain makes Reverse reject addresses which are not at
+	// Domain or one of AltDomains with ErrWrongDomain, optional. By default
+	// the host is ignored on reverse.
+	StrictReverseDomain bool
+	// TimedSecrets are secrets with activation time, optional. Forward signs
+	// with the newest active secret instead of Secret, Reverse verifies with
+	// Secret, SecondarySecrets and timed secrets which were active on the day
+	// of address timestamp, or all activated ones for SRS1.
+	TimedSecrets []TimedSecret
+	// SecretForDomain returns secret for original domain, optional. Domain
+	// is passed lower-cased and Secret is used if func is nil or returns nil.
+	// Original domain is the domain embedded in SRS address, sender domain
+	// for SRS0 and previous forwarder domain for SRS1. Reverse parses the
+	// address first and then verifies the hash with the secret for that domain.
+	SecretForDomain func(origDomain string) []byte
+	// Compatibility preset of FirstSeparator, HashLength and MaxAge matching
+	// other SRS implementation, optional. Preset sets only options which are
+	// not set, so they can be overridden. Set Lenient for foreign addresses
+	// these implementations accept, like SRS0 without hash field.
+	Compatibility Compatibility
 	// FirstSeparator after SRS0, optional, can be =+-, default is =
 	FirstSeparator string
+	// SchemeTag is letter or digit prepended to hash field and hash input, optional.
+	// Reverse of engine with SchemeTag rejects untagged addresses, so tag can be
+	// used to recognize addresses minted with different hashing scheme. Default
+	// 0 is no tag.
+	SchemeTag byte
+	// Version of address format, optional. Version 0 is the default format,
+	// version 1 prepends version digit to hash field and hash input, so
+	// Reverse of engines with older Version rejects the address with
+	// ErrUnsupportedVersion. Reverse accepts versions up to Version.
+	Version int
+	// FieldLayout is order of hash and timestamp in SRS0 address, optional,
+	// default is LayoutStandard. It must be the same on all engines reversing
+	// the addresses, other layout is rejected.
+	FieldLayout FieldLayout
+	// UppercaseHash upper-cases hash field of addresses minted by Forward,
+	// optional, for interop with implementations expecting it. Hash field is
+	// compared case insensitive, so Reverse accepts it in any mode.
+	UppercaseHash bool
+	// CaseSensitiveHash disables lower-casing of hash input, optional. Use it for
+	// interop with implementations which don't lower-case, it is applied on
+	// both forward and reverse, so addresses are not compatible with default mode.
+	CaseSensitiveHash bool
+	// DelimitHashInput separates timestamp, host and user in hash input with
+	// NUL byte, optional. Without it the hash binds only concatenation of the
+	// fields, so hash of host netmark.rs and user milos also validates host
+	// netmark.r and user smilos. Addresses are not compatible with default mode.
+	DelimitHashInput bool
+	// BindDomainLength includes byte length of original domain in hash input,
+	// optional, so hash validates only the host and user boundary it was
+	// minted with, like DelimitHashInput. Addresses are not compatible with
+	// default mode.
+	BindDomainLength bool
+	// NormalizeUnicode converts address to Unicode NFC form in Forward and
+	// Reverse, optional, so NFC and NFD forms of the same address hash equally.
+	// It returns ErrUnicodeConfig in srs_nomail build.
+	NormalizeUnicode bool
+	// IDNA makes Forward encode Unicode original domain to xn-- form with
+	// UTS #46 mapping and Reverse decode it back, optional. It returns
+	// ErrUnicodeConfig in srs_nomail build.
+	IDNA bool
+	// BindHost includes host of SRS address in hash input, optional. Address
+	// is then valid only at the domain it was minted for, Domain or host
+	// returned by OutDomainFunc. Addresses are not compatible with default mode.
+	BindHost bool
+	// InstanceSalt derives per-instance key HMAC(secret, InstanceSalt) of every
+	// hash, optional. Like a second secret chosen by operator, it makes
+	// addresses of instances with different salt not interchangeable even if
+	// they share Secret. Addresses are not compatible with default mode.
+	InstanceSalt []byte
+	// BindForwardingDomain includes Domain in hash input, optional. Address
+	// minted by one forwarder can't be reversed by forwarder with different
+	// Domain, even with shared secret. Addresses are not compatible with
+	// default mode.
+	BindForwardingDomain bool
+	// FullChecksum appends checksum of the whole SRS local part as the last
+	// field, optional. Reverse verifies it, so changing any character of the
+	// address is detected. Addresses are not compatible with default mode.
+	FullChecksum bool
+	// StrictFields makes Reverse reject SRS addresses whose host doesn't look
+	// like domain name or user isn't dot-atom local part, optional. It limits
+	// forgeries which shift the boundary between host and user in hash input,
+	// but rejects quoted local parts and hosts without dot.
+	StrictFields bool
+	// TruncateBeforeEncode truncates HMAC digest to bytes covering HashLength
+	// characters before base64 encoding, optional, for interop with
+	// implementations doing so. Base64 is prefix stable, so hash is the same
+	// as default at any HashLength, the option is a no-op at default 4 too.
+	TruncateBeforeEncode bool
+	// Lenient parsing of nonstandard foreign SRS addresses, optional, like
+	// SRS0 with fields separated by any of =+-
+	Lenient bool
+	// HashLength is number of hash characters in SRS address, optional, default is 4
+	HashLength int
+	// StrictSRS1 makes Reverse of SRS1 address verify hash of inner SRS0 address
+	// with own secrets too, optional, for forwarders sharing Secret. Invalid
+	// outer and inner hash are reported as ErrSRS1HashInvalid and
+	// ErrSRS0HashInvalid instead of ErrHashInvalid.
+	StrictSRS1 bool
+	// RejectSRS1 makes Reverse reject all SRS1 addresses and Forward reject
+	// foreign SRS1 addresses with ErrSRS1Rejected, optional, for forwarders
+	// which never chain.
+	RejectSRS1 bool
+	// KeepSRS1 makes Forward return foreign SRS1 address unchanged instead of
+	// rewriting it, optional. It has precedence over RejectSRS1.
+	KeepSRS1 bool
+	// NormalizeReverseSeparator makes Reverse of SRS1 address return SRS0
+	// address with FirstSeparator instead of the separator used by the
+	// original forwarder, optional. Default is exact reconstruction.
+	NormalizeReverseSeparator bool
+	// Prefixes of SRS0 and SRS1 addresses, optional, default is SRS0 and SRS1
+	Prefixes Prefixes
+	// Store is called by Forward with local part of every minted SRS address
+	// and the original address, optional. Use it to persist the mapping.
+	Store func(srsLocal, original string)
+	// Lookup is called by Reverse with SRS local part when hash or timestamp
+	// validation fails, optional. It should return the original address
+	// persisted by Store, which allows hybrid hash and database mode.
+	Lookup func(srsLocal string) (original string, ok bool)
+	// URLDecodeInput makes Reverse percent-decode the address first, optional.
+	// Plus sign is kept as is since it is a valid SRS separator, it is never
+	// decoded as space like in form encoding.
+	URLDecodeInput bool
+	// CacheSize is number of recent Forward results kept in LRU cache,
+	// optional, default 0 is no cache. Results are cached per time slot and
+	// Secret, cache hits don't call Store since the address was stored on miss.
+	CacheSize int
+	// MaxInputLength of address accepted by Forward and Reverse, optional,
+	// default is 1024. Longer addresses are rejected with ErrInputTooLong
+	// before parsing.
+	MaxInputLength int
+	// NowFunc returns current time for timestamps, optional, default is time.Now
+	NowFunc func() time.Time
+	// TimeEpoch from which time slots are counted, optional, default is Unix
+	// epoch. Recent epoch gives 1 character timestamps for the first 32 days.
+	// Forward and Reverse must use the same epoch.
+	TimeEpoch time.Time
+	// OutDomainFunc returns host of SRS addresses minted by Forward for
+	// original domain, optional, default is Domain. Use it to route SRS
+	// addresses via derived host like "srs." + Domain. Reverse ignores the host, but
+	// operator is responsible for routing both Domain and derived hosts to
+	// the engine.
+	OutDomainFunc func(origDomain string) string
+	// NoTimestamp omits timestamp field, Forward returns SRS0=hash=host=user
+	// and Reverse doesn't check expiry, optional. Addresses never expire and
+	// are not compatible with default mode.
+	NoTimestamp bool
+	// FixedTimestampWidth left-pads timestamp with A to the same width for all
+	// days, 2 characters for 1024 TimeSlots, optional. Reverse accepts both.
+	// It is ignored with TimestampCodec.
+	FixedTimestampWidth bool
+	// TimestampCodec encodes and decodes timestamp field, optional, default
+	// is base32 like in other SRS implementations. Addresses are not
+	// compatible with default mode.
+	TimestampCodec TimestampCodec
+	// RandomNonce appends 4 random base32 characters to timestamp field of
+	// SRS0 address, covered by hash, so forwards of the same address differ,
+	// optional. Reverse ignores the nonce. It changes the address format, so
+	// it must be set on all engines reversing the addresses, and it is ignored
+	// with NoTimestamp.
+	RandomNonce bool
+	// RejectExpiredInner makes Reverse reject SRS1 address whose inner SRS0
+	// timestamp is valid and expired, optional. Inner timestamp is decoded with
+	// nonce if RandomNonce is set. SRS1 without inner timestamp or with
+	// timestamp which can't be decoded is still accepted.
+	RejectExpiredInner bool
+	// MaxAge in days of SRS0 timestamp accepted by Reverse, optional, default
+	// is 21. It must be less than TimeSlots days of timestamp cycle.
+	MaxAge int
+	// TimeSlots is number of days in timestamp cycle, optional, default and
+	// maximum is 1024 like in other SRS implementations
+	TimeSlots int
+	// LegacyTimeSlots are previous TimeSlots tried by Reverse if timestamp is
+	// rejected with TimeSlots, optional, to reverse addresses forwarded before
+	// TimeSlots was changed. Timestamp alone doesn't tell which cycle it was
+	// minted in, so an address expired under TimeSlots may still be accepted
+	// if it is fresh under some legacy cycle. Remove them once MaxAge passes.
+	LegacyTimeSlots []int
+	// MaxAgeForDomain returns max age in days for SRS address of original
+	// domain, optional. Non-positive result falls back to MaxAge.
+	MaxAgeForDomain func(origDomain string) int
+	// OnNearExpiry is called by Reverse with SRS0 address which is valid, but
+	// expires within NearExpiry, and time remaining until it expires, optional
+	OnNearExpiry func(email string, remaining time.Duration)
+	// NearExpiry is threshold for OnNearExpiry, optional, default is one day
+	NearExpiry time.Duration
+	// GracePeriod in days after max age in which ReverseGraceful still reverses
+	// the address and reports it as expired, optional
+	GracePeriod int
+
+	defaultsDone uint32 // set atomically after setDefaults
+	defaultsErr  error
+	stats        *counters
+	cache        *lruCache
+	last         *lruCache
+	srs0Len      int // length of SRS0 prefix with first separator
+	srs1Len      int // length of SRS1 prefix with first separator
+}
+
+// Forward returns SRS forward address of email for domain using secret and
+// default settings, same as SRS.Forward
+func Forward(secret []byte, domain, email string) (string, error) {
+	srs := SRS{Secret: secret, Domain: domain}
+	return srs.Forward(email)
+}
+
+// Reverse returns original address of SRS email for domain using secret and
+// default settings, same as SRS.Reverse
+func Reverse(secret []byte, domain, email string) (string, error) {
+	srs := SRS{Secret: secret, Domain: domain}
+	return srs.Reverse(email)
+}
 
-	defaultsChecked bool
+// Prefixes used to recognize and emit SRS addresses
+type Prefixes struct {
+	SRS0 string
+	SRS1 string
 }
 
-// Forward returns SRS forward address or error
+// Forward returns SRS forward address or error. Only local parts starting with
+// SRS0 or SRS1 prefix followed by separator are SRS addresses, so bare SRS0@domain
+// is rewritten as regular address and reversed back to SRS0@domain.
+// Addresses at Domain are returned unchanged. This check has precedence over
+// SRS prefix detection, so SRS addresses minted by the engine are never rewrapped.
+// Returned SRS address is safe for SMTP commands and headers, its local part is
+// dot-atom which needs no quoting. Quoted local parts which are not dot-atom,
+// like "john doe"@example.com or "a@b"@example.com, return ErrUnsafeAddress.
 func (srs *SRS) Forward(email string) (string, error) {
-	srs.setDefaults()
+	if err := srs.setDefaults(); err != nil {
+		return "", err
+	}
+
+	fwd, err := srs.cachedForward(srs.cache, email)
+	srs.stats.count(err, &srs.stats.forwards)
+	return fwd, err
+}
+
+// CanForward returns error which Forward would return for email, or nil if
+// Forward would succeed. Store is not called and stats are not counted.
+func (srs *SRS) CanForward(email string) error {
+	if err := srs.setDefaults(); err != nil {
+		return err
+	}
+
+	dry := *srs
+	dry.Store = nil
+	_, err := dry.forward(email)
+	return err
+}
+
+// WouldRewrite reports whether Forward would rewrite email, with parsing and
+// domain comparison only, without hashing. Addresses at Domain, AltDomains and
+// LocalDomainSuffix are passed through, like foreign SRS1 with KeepSRS1. Error
+// is the one Forward would return for parsing, like ErrEmptyDomain or
+// ErrSRS1Rejected.
+func (srs *SRS) WouldRewrite(email string) (bool, error) {
+	if err := srs.setDefaults(); err != nil {
+		return false, err
+	}
+
+	_, _, _, _, rewrite, err := srs.classify(email)
+	return rewrite, err
+}
+
+// forward returns SRS forward address or error
+func (srs *SRS) forward(email string) (string, error) {
+	email, local, hostname, srsHost, rewrite, err := srs.classify(email)
+	if err != nil || !rewrite {
+		return email, err
+	}
+
+	fwd, out, err := srs.forwardAs(srs.kind(local), local, srsHost)
+	if err != nil {
+		return "", err
+	}
+	if srs.Store != nil {
+		srs.Store(fwd, local+"@"+hostname)
+	}
+	return out, nil
+}
+
+// classify parses email for Forward and returns normalized email, its local
+// part, original domain, which is empty for address like user@, and original
+// domain as embedded in SRS address. Rewrite is false if Forward returns email
+// unchanged, like address at Domain or foreign SRS1 with KeepSRS1. Nothing is
+// hashed.
+func (srs *SRS) classify(email string) (normalized, local, hostname, srsHost string, rewrite bool, err error) {
+	if len(email) > srs.MaxInputLength {
+		return "", "", "", "", false, ErrInputTooLong
+	}
+	if srs.NormalizeUnicode {
+		email = nfc(email)
+	}
 
 	var noDomain bool
 	if strings.HasSuffix(email, "@") {
@@ -42,97 +392,425 @@ func (srs *SRS) Forward(email string) (string, error) {
 		noDomain = true
 	}
 
-	local, hostname, err := parseEmail(email)
+	local, hostname, err = parseEmail(email)
 	if err != nil {
-		return "", err
+		return "", "", "", "", false, err
 	}
 	if noDomain {
+		if srs.RejectEmptyDomain {
+			return "", "", "", "", false, ErrEmptyDomain
+		}
 		hostname = ""
 	}
 
-	if hostname == srs.Domain {
-		return email, nil
+	if srs.isLocalDomain(hostname) {
+		return email, local, hostname, "", false, nil
 	}
 
-	if len(local) < 5 {
-		return srs.rewrite(local, hostname)
+	srsHost, err = srs.srsHost(hostname)
+	if err != nil {
+		return "", "", "", "", false, err
 	}
 
-	switch local[:5] {
-	case "SRS0=", "SRS0+", "SRS0-":
-		return srs.rewriteSRS0(local, hostname)
-
-	case "SRS1=", "SRS1+", "SRS1-":
-		return srs.rewriteSRS1(local, hostname)
+	if srs.kind(local) == KindSRS1 {
+		switch {
+		case srs.KeepSRS1:
+			return email, local, hostname, srsHost, false, nil
+		case srs.RejectSRS1:
+			return "", "", "", "", false, ErrSRS1Rejected
+		}
+	}
+	return email, local, hostname, srsHost, true, nil
+}
 
+// forwardAs rewrites local part like address of kind and returns SRS local
+// part with full checksum and SRS address, or ErrUnsafeAddress if it is not
+// safe for SMTP
+func (srs *SRS) forwardAs(kind Kind, local, srsHost string) (fwd, out string, err error) {
+	switch kind {
+	case KindSRS0:
+		fwd, err = srs.rewriteSRS0(local, srsHost)
+	case KindSRS1:
+		fwd, err = srs.rewriteSRS1(local, srsHost)
 	default:
-		return srs.rewrite(local, hostname)
+		fwd, err = srs.rewrite(local, srsHost)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	fwd = srs.addChecksum(fwd)
+	out = fwd + "@" + srs.outDomain(srsHost)
+	if !isDotAtom(fwd) || !isSMTPSafe(out) {
+		return "", "", ErrUnsafeAddress
+	}
+	return fwd, out, nil
+}
+
+// srsHost returns original domain as embedded in SRS address, punycode
+// encoded if IDNA is set
+func (srs *SRS) srsHost(hostname string) (string, error) {
+	if !srs.IDNA {
+		return hostname, nil
+	}
+	ace, err := toASCII(hostname)
+	if err != nil {
+		return "", ErrBadFormat
+	}
+	return ace, nil
+}
+
+// ForwardVariants returns SRS0 rewrite of email as if it were plain address
+// and SRS1 rewrite if email is SRS0 or SRS1 address, for diagnostics. Variants
+// are built like by Forward, so one of them is what Forward returns. Variant
+// which is not applicable is empty, so both are empty for address which
+// Forward returns unchanged, like address at Domain. Unlike Forward it doesn't
+// call Store.
+func (srs *SRS) ForwardVariants(email string) (srs0, srs1 string, err error) {
+	if err := srs.setDefaults(); err != nil {
+		return "", "", err
+	}
+
+	_, local, _, srsHost, rewrite, err := srs.classify(email)
+	if err != nil || !rewrite {
+		return "", "", err
+	}
+	if kind := srs.kind(local); kind != KindPlain {
+		if _, srs1, err = srs.forwardAs(kind, local, srsHost); err != nil {
+			return "", "", err
+		}
+	}
+	if _, srs0, err = srs.forwardAs(KindPlain, local, srsHost); err != nil {
+		return "", "", err
+	}
+	return srs0, srs1, nil
+}
+
+// ForwardWithORCPT returns SRS forward address of envelope sender and RFC 3461
+// ORCPT value of original recipient, in form rfc822;xtext-encoded-address, so
+// MTA can set it on the forwarded RCPT
+func (srs *SRS) ForwardWithORCPT(sender, recipient string) (srsAddr, orcpt string, err error) {
+	local, host, err := parseEmail(recipient)
+	if err != nil {
+		return "", "", err
+	}
+	srsAddr, err = srs.Forward(sender)
+	if err != nil {
+		return "", "", err
+	}
+	return srsAddr, "rfc822;" + xtext(local+"@"+host), nil
+}
+
+// xtext encodes string as defined in RFC 3461, section 4
+func xtext(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '!' || c > '~' || c == '+' || c == '=' {
+			fmt.Fprintf(&b, "+%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// outDomain returns host of SRS address minted for original domain
+func (srs *SRS) outDomain(origDomain string) string {
+	if srs.OutDomainFunc != nil {
+		return srs.OutDomainFunc(origDomain)
+	}
+	return srs.Domain
+}
+
+// isLocalDomain reports whether hostname is forwarding Domain, one of
+// AltDomains or matches LocalDomainSuffix, case insensitive
+func (srs SRS) isLocalDomain(hostname string) bool {
+	if strings.EqualFold(hostname, srs.Domain) {
+		return true
+	}
+	for _, domain := range srs.AltDomains {
+		if strings.EqualFold(hostname, domain) {
+			return true
+		}
+	}
+	if srs.LocalDomainSuffix != "" {
+		suffix := "." + strings.TrimPrefix(srs.LocalDomainSuffix, ".")
+		if strings.EqualFold(hostname, suffix[1:]) {
+			return true
+		}
+		if len(hostname) > len(suffix) && strings.EqualFold(hostname[len(hostname)-len(suffix):], suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptedPrefixes returns local part prefixes of SRS addresses recognized by
+// Forward and Reverse, like SRS0=, SRS0+, SRS0-, SRS1=, SRS1+ and SRS1-
+func (srs *SRS) AcceptedPrefixes() []string {
+	srs.setDefaults()
+	var prefixes []string
+	for _, prefix := range []string{srs.Prefixes.SRS0, srs.Prefixes.SRS1} {
+		for _, s := range firstSeparators {
+			prefixes = append(prefixes, prefix+s)
+		}
+	}
+	return prefixes
+}
+
+// Separators returns first separators accepted after SRS0 and SRS1 prefix by
+// Reverse and allowed in FirstSeparator, that is =, + and -
+func Separators() []string {
+	return append([]string(nil), firstSeparators...)
+}
+
+// firstSeparators allowed after SRS0 and SRS1 prefix
+var firstSeparators = []string{"=", "+", "-"}
+
+// hasPrefix reports whether local part starts with prefix followed by one of =+-
+func hasPrefix(local, prefix string) bool {
+	n := len(prefix) + firstSepLen
+	if len(local) < n || local[:len(prefix)] != prefix {
+		return false
+	}
+	for _, s := range firstSeparators {
+		if local[len(prefix):n] == s {
+			return true
+		}
 	}
+	return false
 }
 
-// rewrite email address
+// rewrite email address and return SRS0 local part
 func (srs SRS) rewrite(local, hostname string) (string, error) {
-	ts := base32Encode(timestamp())
-	return "SRS0" + srs.FirstSeparator + srs.hash([]byte(strings.ToLower(ts+hostname+local))) + sep + ts + sep + hostname + sep + local + "@" + srs.Domain, nil
+	ts, err := srs.forwardTimestamp()
+	if err != nil {
+		return "", err
+	}
+	hash := srs.signature(hostname, srs.hashInput0(srs.outDomain(hostname), ts, hostname, local))
+	if srs.NoTimestamp {
+		return srs.Prefixes.SRS0 + srs.FirstSeparator + hash + sep + hostname + sep + local, nil
+	}
+	first, second := srs.FieldLayout.order(hash, ts)
+	return srs.Prefixes.SRS0 + srs.FirstSeparator + first + sep + second + sep + hostname + sep + local, nil
 }
 
-// rewriteSRS0 rewrites SRS0 address to SRS1
+// forwardTimestamp returns encoded timestamp of forwarded address, empty
+// if NoTimestamp is set
+func (srs SRS) forwardTimestamp() (string, error) {
+	if srs.NoTimestamp {
+		return "", nil
+	}
+	now, err := srs.timestamp()
+	if err != nil {
+		return "", err
+	}
+	if srs.RandomNonce {
+		nonce, err := randomNonce()
+		if err != nil {
+			return "", err
+		}
+		return srs.encodeTimestamp(now) + nonce, nil
+	}
+	return srs.encodeTimestamp(now), nil
+}
+
+// encodeTimestamp returns timestamp encoded by TimestampCodec, base32 one is
+// left-padded with A to width of the last time slot if FixedTimestampWidth is set
+func (srs SRS) encodeTimestamp(x int) string {
+	if srs.TimestampCodec != nil {
+		return srs.TimestampCodec.Encode(x)
+	}
+	ts := base32Encode(x)
+	if !srs.FixedTimestampWidth {
+		return ts
+	}
+	width := 1
+	for last := srs.slots() - 1; last >= baseSize; last /= baseSize {
+		width++
+	}
+	if len(ts) < width {
+		ts = strings.Repeat(base32[:1], width-len(ts)) + ts
+	}
+	return ts
+}
+
+// randomNonce returns random base32 string of nonceLen characters
+func randomNonce() (string, error) {
+	b := make([]byte, nonceLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = base32[b[i]%baseSize]
+	}
+	return string(b), nil
+}
+
+// timestampSlot returns timestamp field of SRS0 address without nonce, nonce
+// is ignored with NoTimestamp
+func (srs SRS) timestampSlot(ts string) (string, error) {
+	if srs.NoTimestamp || !srs.RandomNonce {
+		return ts, nil
+	}
+	if len(ts) < nonceLen {
+		return "", ErrTimestampInvalidBase32
+	}
+	return ts[:len(ts)-nonceLen], nil
+}
+
+// rewriteSRS0 rewrites SRS0 address to SRS1 local part. Malformed SRS0 with
+// less than 4 fields, like SRS0=abcd, is rejected with ErrNoUserSRS0. Foreign
+// SRS0 fields are kept as opaque data, so in lenient mode any field count is
+// accepted, like SRS0 without hash field, which is what postsrsd does.
 func (srs SRS) rewriteSRS0(local, hostname string) (string, error) {
-	srsLocal, srsHash, srsTimestamp, srsHost, srsUser, err := srs.parseSRS0(local)
+	srsLocal, _, _, _, _, err := srs.parseSRS0(local)
 	if err != nil {
-		return "", errors.New("No user in SRS0 address")
+		if !srs.Lenient || len(local) == srs.srs0Len {
+			return "", ErrNoUserSRS0
+		}
+		srsLocal = local[srs.srs0Len-firstSepLen:]
 	}
-	hash := srs.hash([]byte(strings.ToLower(hostname + srsLocal)))
-	return "SRS1" + srs.FirstSeparator + hash + sep + hostname + sep + string(local[4]) + srsHash + sep + srsTimestamp + sep + srsHost + sep + srsUser + "@" + srs.Domain, nil
+	hash := srs.signature(hostname, srs.hashInput1(srs.outDomain(hostname), hostname, srsLocal))
+	return srs.Prefixes.SRS1 + srs.FirstSeparator + hash + sep + hostname + sep + srsLocal, nil
 }
 
 // parseSRS0 local part and return hash, ts, host and local
 func (srs SRS) parseSRS0(local string) (srsLocal, srsHash, srsTimestamp, srsHost, srsUser string, err error) {
-	parts := strings.SplitN(local[5:], sep, 4)
+	if srs.NoTimestamp {
+		parts := strings.SplitN(local[srs.srs0Len:], sep, 3)
+		if len(parts) < 3 {
+			return "", "", "", "", "", ErrNoUserSRS0
+		}
+		return local[srs.srs0Len-firstSepLen:], parts[0], "", parts[1], parts[2], nil
+	}
+
+	parts := strings.SplitN(local[srs.srs0Len:], sep, 4)
 	if len(parts) < 4 {
-		return "", "", "", "", "", errors.New("No user in SRS0 address")
+		if f, ok := splitMixedSRS0(local[srs.srs0Len:]); ok && srs.Lenient && srs.FieldLayout == LayoutStandard {
+			return local[srs.srs0Len-firstSepLen:], f[0], f[1], f[2], f[3], nil
+		}
+		return "", "", "", "", "", ErrNoUserSRS0
 	}
-	return local[4:], parts[0], parts[1], parts[2], parts[3], nil
+	srsHash, srsTimestamp = srs.FieldLayout.order(parts[0], parts[1])
+	return local[srs.srs0Len-firstSepLen:], srsHash, srsTimestamp, parts[2], parts[3], nil
 }
 
-// rewriteSRS1 rewrites SRS1 address to new SRS1
+// splitMixedSRS0 splits SRS0 fields after prefix delimited by any of =+-, like
+// hash+ts=host+user of some foreign implementations. Timestamp is the first
+// base32 field of up to 2 characters after hash of at least 3 characters, and
+// host ends at = or +, since it may contain -.
+func splitMixedSRS0(s string) (fields [4]string, ok bool) {
+	for i := minHashLength; i < len(s); i++ {
+		if !isFieldSep(s[i]) {
+			continue
+		}
+		j := i + 1
+		for j < len(s) && j-i-1 < maxTsLength && strings.IndexByte(base32, upperASCII(s[j])) != -1 {
+			j++
+		}
+		if j == i+1 || j == len(s) || !isFieldSep(s[j]) {
+			continue
+		}
+		rest := s[j+1:]
+		if k := strings.IndexAny(rest, "=+"); k > 0 && k < len(rest)-1 {
+			return [4]string{s[:i], s[i+1 : j], rest[:k], rest[k+1:]}, true
+		}
+	}
+	return fields, false
+}
+
+// isFieldSep reports whether c is one of =+- separators
+func isFieldSep(c byte) bool {
+	return c == '=' || c == '+' || c == '-'
+}
+
+// upperASCII returns upper-cased ASCII letter or c
+func upperASCII(c byte) byte {
+	if 'a' <= c && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+// compoundSepIndex returns index of first ==, =+ or =- in local part starting
+// from index from, or -1
+func compoundSepIndex(local string, from int) int {
+	for i := from; i < len(local)-1; i++ {
+		switch local[i : i+2] {
+		case "==", "=+", "=-":
+			return i
+		}
+	}
+	return -1
+}
+
+// srs1SepIndex returns index of compound separator after hash and host of SRS1
+// local part, or -1. Foreign hash may be shorter or longer than HashLength,
+// start with + or - and end with = padding, so separator must follow the
+// separator after hash and nonempty host, which can't contain =.
+func (srs SRS) srs1SepIndex(local string) int {
+	from := srs.srs1Len
+	for i := from; i < len(local)-1; i++ {
+		if i = compoundSepIndex(local, i); i == -1 {
+			return -1
+		}
+		if local[i-1] != '=' && strings.Contains(local[from:i], sep) {
+			return i
+		}
+	}
+	return -1
+}
+
+// rewriteSRS1 rewrites SRS1 address to new SRS1 local part
 func (srs SRS) rewriteSRS1(local, hostname string) (string, error) {
-	srsLocal, _, srs1Host, srsHash, srsTimestamp, srsHost, srsUser, err := srs.parseSRS1(local)
+	srsLocal, _, srs1Host, _, _, _, _, err := srs.parseSRS1(local)
 	if err != nil {
 		return "", err
 	}
 
-	hash := srs.hash([]byte(strings.ToLower(srs1Host + srsLocal)))
-	return "SRS1" + srs.FirstSeparator + hash + sep + srs1Host + sep + string(local[4]) + srsHash + sep + srsTimestamp + sep + srsHost + sep + srsUser + "@" + srs.Domain, nil
+	// srsLocal keeps original SRS0 separator and opaque SRS0 data
+	hash := srs.signature(srs1Host, srs.hashInput1(srs.outDomain(hostname), srs1Host, srsLocal))
+	return srs.Prefixes.SRS1 + srs.FirstSeparator + hash + sep + srs1Host + sep + srsLocal, nil
 }
 
 // parseSRS1 local part and return hash, ts, host and local
 func (srs SRS) parseSRS1(local string) (srsLocal, srs1Hash, srs1Host, srsHash, srsTimestamp, srsHost, srsUser string, err error) {
 	var srs1Sep, srs1First, srs1Second string
-	for i := 0; i < len(local)-1; i++ {
-		sep := local[i : i+2]
-		if sep == "==" || sep == "=+" || sep == "=-" {
-			srs1Sep = string(local[i+1])
-			srs1First = local[0:i]
-			srs1Second = local[i+2:]
-			break
+	if i := srs.srs1SepIndex(local); i != -1 {
+		srs1Sep = string(local[i+1])
+		srs1First = local[0:i]
+		srs1Second = local[i+2:]
+	} else if compoundSepIndex(local, srs.srs1Len) != -1 {
+		// the only compound separator is within hash field
+		return "", "", "", "", "", "", "", ErrHashTooShort
+	}
+
+	// Mail::SRS compatible SRS1 with single separator after host in lenient mode,
+	// SRS0 separator is missing so default = is assumed
+	if srs1First == "" && srs1Second == "" && srs.Lenient {
+		if f := strings.SplitN(local[srs.srs1Len:], sep, 3); len(f) == 3 && f[2] != "" {
+			srs1Sep = sep
+			srs1First = local[:srs.srs1Len] + f[0] + sep + f[1]
+			srs1Second = f[2]
 		}
 	}
 
 	if srs1First == "" && srs1Second == "" {
-		return "", "", "", "", "", "", "", errors.New("No user in SRS1 address")
+		return "", "", "", "", "", "", "", ErrNoUserSRS1
 	}
 
-	if len(srs1First) <= 8 {
-		return "", "", "", "", "", "", "", errors.New("Hash too short in SRS address")
+	// first part is prefix, hash, separator and host
+	if len(srs1First) <= srs.srs1Len+minHashLength {
+		return "", "", "", "", "", "", "", ErrHashTooShort
 	}
 
 	srsLocal = srs1Sep + srs1Second
 
-	h := strings.SplitN(srs1First[5:], sep, 2)
-	if len(h) == 2 {
-		srs1Hash = h[0]
-		srs1Host = h[1]
+	// host can't contain separator, but foreign hash may
+	if i := strings.LastIndex(srs1First, sep); i >= srs.srs1Len {
+		srs1Hash = srs1First[srs.srs1Len:i]
+		srs1Host = srs1First[i+len(sep):]
 	}
 
 	parts := strings.SplitN(srs1Second, sep, 4)
@@ -140,67 +818,826 @@ func (srs SRS) parseSRS1(local string) (srsLocal, srs1Hash, srs1Host, srsHash, s
 		return srsLocal, srs1Hash, srs1Host, "", "", "", "", nil
 	}
 
-	return srsLocal, srs1Hash, srs1Host, parts[0], parts[1], parts[2], parts[3], nil
+	srsHash, srsTimestamp = srs.FieldLayout.order(parts[0], parts[1])
+	return srsLocal, srs1Hash, srs1Host, srsHash, srsTimestamp, parts[2], parts[3], nil
 }
 
-// Reverse the SRS email address to regular email addresss or error
+// Reverse the SRS email address to regular email addresss or error. Original
+// address is returned with the case it had at forward time, since only the hash
+// input is lower-cased.
+// ErrTimestampExpired is returned only for SRS0 address with valid hash, so it
+// can be told apart from forged address, which returns ErrHashInvalid.
 func (srs *SRS) Reverse(email string) (string, error) {
-	srs.setDefaults()
+	rvs, _, err := srs.reverseEmail(email, 0)
+	rvs, _ = srs.unicodeAddress(rvs)
+	return rvs, err
+}
 
-	local, _, err := parseEmail(email)
+// ReverseUnicode reverses the SRS email address like Reverse and reports
+// whether the host of original address is kept in xn-- form because IDNA
+// decoding failed. Reverse returns such address without error, since it is
+// still deliverable.
+func (srs *SRS) ReverseUnicode(email string) (orig string, ace bool, err error) {
+	rvs, _, err := srs.reverseEmail(email, 0)
 	if err != nil {
-		return "", errors.New("Not an SRS address")
+		return "", false, err
 	}
+	rvs, ok := srs.unicodeAddress(rvs)
+	return rvs, !ok, nil
+}
 
-	if len(local) < 5 {
-		return "", errors.New("Not an SRS address")
+// unicodeAddress returns address with host decoded from xn-- form if IDNA is
+// set, and false if some labels can't be decoded
+func (srs *SRS) unicodeAddress(addr string) (string, bool) {
+	at := strings.LastIndexByte(addr, '@')
+	if !srs.IDNA || at == -1 {
+		return addr, true
 	}
+	host, ok := toUnicode(addr[at+1:])
+	return addr[:at+1] + host, ok
+}
 
-	switch local[:5] {
-	case "SRS0=", "SRS0+", "SRS0-":
-		_, srsHash, srsTimestamp, srsHost, srsUser, err := srs.parseSRS0(local)
+// ReverseAt reverses the SRS email address like Reverse, but timestamp is
+// checked as it would be at time t, for replaying historical logs. NowFunc of
+// the engine is not changed.
+func (srs *SRS) ReverseAt(email string, t time.Time) (string, error) {
+	if err := srs.setDefaults(); err != nil {
+		return "", err
+	}
+
+	at := *srs
+	at.NowFunc = func() time.Time { return t }
+	return at.Reverse(email)
+}
+
+// Reseparate reverses valid SRS address and forwards the original address
+// again with FirstSeparator and fresh timestamp, to migrate live addresses after
+// FirstSeparator is changed. Address which doesn't validate returns the error
+// Reverse would return.
+func (srs *SRS) Reseparate(email string) (string, error) {
+	if err := srs.setDefaults(); err != nil {
+		return "", err
+	}
+
+	orig, _, err := srs.reverseAddress(email, 0)
+	if err != nil {
+		return "", err
+	}
+	return srs.Forward(orig)
+}
+
+// ReverseGraceful reverses the SRS email address like Reverse, but address with
+// timestamp older than max age and within GracePeriod days is still reversed and
+// reported as expired. Beyond the grace period it returns an error.
+func (srs *SRS) ReverseGraceful(email string) (orig string, expired bool, err error) {
+	orig, expired, err = srs.reverseEmail(email, srs.GracePeriod)
+	orig, _ = srs.unicodeAddress(orig)
+	return orig, expired, err
+}
+
+// ReverseQuarantine reverses the SRS email address like Reverse, but address
+// with valid hash and timestamp of any age is reversed and reported as
+// expired, so stale bounces can be routed to quarantine. Invalid hash is
+// still rejected with ErrHashInvalid.
+func (srs *SRS) ReverseQuarantine(email string) (orig string, expired bool, err error) {
+	orig, expired, err = srs.reverseEmail(email, int(timeSlots))
+	orig, _ = srs.unicodeAddress(orig)
+	return orig, expired, err
+}
+
+// reverseEmail reverses the SRS email address allowing timestamps within grace days after max age
+func (srs *SRS) reverseEmail(email string, grace int) (string, bool, error) {
+	if err := srs.setDefaults(); err != nil {
+		return "", false, err
+	}
+
+	rvs, expired, err := srs.reverseAddress(email, grace)
+	srs.stats.count(err, &srs.stats.reverses)
+	return rvs, expired, err
+}
+
+// reverseAddress reverses the SRS email address with URL decoding and Lookup
+func (srs *SRS) reverseAddress(email string, grace int) (string, bool, error) {
+	if len(email) > srs.MaxInputLength {
+		return "", false, ErrInputTooLong
+	}
+
+	if srs.URLDecodeInput {
+		decoded, err := url.PathUnescape(email)
 		if err != nil {
-			return "", err
+			return "", false, ErrBadURLEncoding
 		}
+		email = decoded
+	}
+	if srs.NormalizeUnicode {
+		email = nfc(email)
+	}
+
+	local, hostname, err := parseEmail(email)
+	if err != nil {
+		return "", false, ErrNotSRS
+	}
+	if srs.StrictReverseDomain && !srs.isLocalDomain(hostname) {
+		return "", false, ErrWrongDomain
+	}
+	if srs.RejectSRS1 && srs.kind(local) == KindSRS1 {
+		return "", false, ErrSRS1Rejected
+	}
+
+	rvs, expired, err := srs.reverse(local, hostname, grace)
+	if err != nil && srs.Lookup != nil && srs.kind(local) != KindPlain {
+		if original, ok := srs.Lookup(local); ok {
+			return original, false, nil
+		}
+	}
+	return rvs, expired, err
+}
 
-		if err := srs.checkTimestamp(srsTimestamp); err != nil {
+// ReverseAll reverses the SRS email address like Reverse and continues to
+// reverse the result while it is SRS0 address, which unwraps SRS0 addresses
+// wrapped twice by broken upstream forwarders. Unwrapping stops at the first
+// inner layer that can't be reversed, like SRS0 signed by another forwarder.
+func (srs *SRS) ReverseAll(email string) (string, error) {
+	rvs, err := srs.Reverse(email)
+	if err != nil {
+		return "", err
+	}
+	for {
+		local, hostname, err := parseEmail(rvs)
+		if err != nil || srs.kind(local) != KindSRS0 {
+			return rvs, nil
+		}
+		inner, _, err := srs.reverse(local, hostname, 0)
+		if err != nil {
+			return rvs, nil
+		}
+		rvs = inner
+	}
+}
+
+// SenderDomain returns innermost original domain of SRS address after hash
+// and timestamp validation like Reverse, so it is safe for policy decisions
+// like SPF re-check. Inner SRS0 of SRS1 is covered by SRS1 hash, so its host
+// is returned, or ErrNoUserSRS0 if inner SRS0 is opaque.
+func (srs *SRS) SenderDomain(email string) (string, error) {
+	rvs, err := srs.Reverse(email)
+	if err != nil {
+		return "", err
+	}
+	for {
+		local, host, err := parseEmail(rvs)
+		if err != nil {
 			return "", err
 		}
+		if srs.kind(local) != KindSRS0 {
+			return host, nil
+		}
+		_, _, _, srsHost, srsUser, err := srs.parseSRS0(local)
+		if err != nil {
+			return "", err
+		}
+		rvs = srsUser + "@" + srsHost
+	}
+}
+
+// DisplayOriginal returns innermost original address of SRS email address
+// without hash and timestamp validation. It is unsafe for delivery decisions
+// and meant only for displaying the real recipient, use Reverse or ReverseAll
+// for delivery.
+func (srs *SRS) DisplayOriginal(email string) (string, error) {
+	if err := srs.setDefaults(); err != nil {
+		return "", err
+	}
+
+	local, host, err := parseEmail(email)
+	if err != nil {
+		return "", err
+	}
+	if srs.kind(local) == KindPlain {
+		return "", ErrNotSRS
+	}
+	if i := strings.LastIndex(local, sep); srs.FullChecksum && i != -1 {
+		local = local[:i]
+	}
+
+	for layer := 0; ; layer++ {
+		var srsLocal, srs1Host, srsHost, srsUser string
+		switch srs.kind(local) {
+		case KindSRS0:
+			_, _, _, srsHost, srsUser, err = srs.parseSRS0(local)
+
+		case KindSRS1:
+			srsLocal, _, srs1Host, _, _, srsHost, srsUser, err = srs.parseSRS1(local)
+			if err == nil && srsUser == "" {
+				// opaque SRS0 data of foreign SRS1
+				return srs.Prefixes.SRS0 + srsLocal + "@" + srs1Host, nil
+			}
+
+		default:
+			return local + "@" + host, nil
+		}
+
+		if err != nil {
+			if layer == 0 {
+				return "", err
+			}
+			// inner layer is not SRS address after all
+			return local + "@" + host, nil
+		}
+		local, host = srsUser, srsHost
+	}
+}
+
+// ReverseChain returns forwarding path of SRS email address, from email to
+// its innermost original address, like SRS1, SRS0 and original address for
+// SRS1. Email is validated like by Reverse, inner layers are validated if
+// they are signed by the engine and split to fields without validation
+// otherwise, like by DisplayOriginal.
+func (srs *SRS) ReverseChain(email string) ([]string, error) {
+	rvs, err := srs.Reverse(email)
+	if err != nil {
+		return nil, err
+	}
 
-		if srsHash != srs.hash([]byte(strings.ToLower(srsTimestamp+srsHost+srsUser))) {
-			return "", errors.New("Hash invalid in SRS address")
+	chain := []string{email, rvs}
+	for {
+		local, host, err := parseEmail(rvs)
+		if err != nil || srs.kind(local) == KindPlain {
+			return chain, nil
+		}
+		if rvs, _, err = srs.reverse(local, host, 0); err != nil {
+			if rvs, err = srs.unwrap(local); err != nil {
+				// inner layer is not SRS address after all
+				return chain, nil
+			}
 		}
+		chain = append(chain, rvs)
+	}
+}
 
+// unwrap returns address wrapped by one layer of SRS local part without
+// validation, original address of SRS0 and SRS0 address of SRS1
+func (srs *SRS) unwrap(local string) (string, error) {
+	switch srs.kind(local) {
+	case KindSRS0:
+		_, _, _, srsHost, srsUser, err := srs.parseSRS0(local)
+		if err != nil {
+			return "", err
+		}
 		return srsUser + "@" + srsHost, nil
 
-	case "SRS1=", "SRS1+", "SRS1-":
-		srsLocal, srs1Hash, srs1Host, _, _, _, _, err := srs.parseSRS1(local)
+	case KindSRS1:
+		srsLocal, _, srs1Host, _, _, _, _, err := srs.parseSRS1(local)
+		if err != nil {
+			return "", err
+		}
+		return srs.Prefixes.SRS0 + srsLocal + "@" + srs1Host, nil
+	}
+	return "", ErrNotSRS
+}
+
+// ReverseHeader reverses SRS address from Return-Path header value or the whole
+// header line, like "Return-Path: <SRS0=...@domain>", "<SRS0=...@domain>" or bare address
+func (srs *SRS) ReverseHeader(headerValue string) (string, error) {
+	v := strings.TrimSpace(headerValue)
+	if len(v) >= len(returnPath) && strings.EqualFold(v[:len(returnPath)], returnPath) {
+		v = strings.TrimSpace(v[len(returnPath):])
+	}
+	if strings.HasPrefix(v, "<") && strings.HasSuffix(v, ">") {
+		v = strings.TrimSpace(v[1 : len(v)-1])
+	}
+	return srs.Reverse(v)
+}
+
+const returnPath = "Return-Path:"
+
+// ExtractAndReverse finds first SRS address in text, like log line, and
+// reverses it. Found is false if text contains no address with accepted SRS
+// prefix, otherwise err is the result of Reverse.
+func (srs *SRS) ExtractAndReverse(text string) (orig string, found bool, err error) {
+	srs.setDefaults()
+	for _, token := range strings.FieldsFunc(text, isTokenDelim) {
+		token = strings.TrimRight(token, ".")
+		at := strings.LastIndex(token, "@")
+		if at <= 0 || at == len(token)-1 || srs.kind(token[:at]) == KindPlain {
+			continue
+		}
+		orig, err = srs.Reverse(token)
+		return orig, true, err
+	}
+	return "", false, nil
+}
+
+// isTokenDelim reports whether r separates address from surrounding text
+func isTokenDelim(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("<>,;:()[]\"'", r)
+}
+
+// reverse SRS local part to regular email address or error, see checkTimestamp for grace
+func (srs SRS) reverse(local, hostname string, grace int) (string, bool, error) {
+	if srs.FullChecksum && srs.kind(local) != KindPlain {
+		var ok bool
+		if local, ok = srs.verifyChecksum(local); !ok {
+			return "", false, ErrHashInvalid
+		}
+	}
+
+	switch srs.kind(local) {
+	case KindSRS0:
+		_, srsHash, srsTimestamp, srsHost, srsUser, err := srs.parseSRS0(local)
+		if err != nil {
+			return "", false, err
+		}
+
+		if srs.StrictFields && !plausibleFields(srsHost, srsUser) {
+			return "", false, ErrImplausibleFields
+		}
+
+		// hash is checked before timestamp age, so expired timestamp is
+		// reported only for genuine addresses, like replayed old bounces
+		slot, err := srs.timestampSlot(srsTimestamp)
+		if err != nil {
+			return "", false, err
+		}
+		if _, err := srs.codec().Decode(slot); err != nil && !srs.NoTimestamp {
+			return "", false, err
+		}
+		if err := srs.checkVersion(srsHash); err != nil {
+			return "", false, err
+		}
+		if !srs.validSignature(srsHost, srsHash, srs.hashInput0(hostname, srsTimestamp, srsHost, srsUser), slot) {
+			return "", false, ErrHashInvalid
+		}
+		if srs.NoTimestamp {
+			return srsUser + "@" + srsHost, false, nil
+		}
+
+		expired, err := srs.checkTimestamp(slot, srsHost, grace)
+		if err != nil {
+			return "", false, err
+		}
+		if srs.OnNearExpiry != nil && !expired {
+			srs.notifyNearExpiry(local+"@"+hostname, slot, srsHost)
+		}
+
+		return srsUser + "@" + srsHost, expired, nil
+
+	case KindSRS1:
+		srsLocal, srs1Hash, srs1Host, srsHash, srsTimestamp, srsHost, srsUser, err := srs.parseSRS1(local)
+		if err != nil {
+			return "", false, err
+		}
+
+		if srs.StrictFields && !isPlausibleDomain(srs1Host) {
+			return "", false, ErrImplausibleFields
+		}
+
+		if err := srs.checkVersion(srs1Hash); err != nil {
+			return "", false, err
+		}
+		if !srs.validSignature(srs1Host, srs1Hash, srs.hashInput1(hostname, srs1Host, srsLocal), "") {
+			if srs.StrictSRS1 {
+				return "", false, ErrSRS1HashInvalid
+			}
+			return "", false, ErrHashInvalid
+		}
+		if srs.StrictSRS1 && !srs.validInner(srs1Host, srsHash, srsTimestamp, srsHost, srsUser) {
+			return "", false, ErrSRS0HashInvalid
+		}
+
+		// inner timestamp is foreign, so only valid and expired one is rejected
+		if srs.RejectExpiredInner && srsTimestamp != "" {
+			if slot, err := srs.timestampSlot(srsTimestamp); err == nil {
+				if _, err := srs.checkTimestamp(slot, srsHost, grace); err == ErrTimestampExpired {
+					return "", false, err
+				}
+			}
+		}
+
+		if srs.NormalizeReverseSeparator {
+			srsLocal = srs.FirstSeparator + srsLocal[firstSepLen:]
+		}
+		return srs.Prefixes.SRS0 + srsLocal + "@" + srs1Host, false, nil
+
+	default:
+		return "", false, ErrNotSRS
+	}
+}
+
+// validInner reports whether hash of inner SRS0 address of SRS1, minted at
+// srs1Host, is valid under own secrets
+func (srs SRS) validInner(srs1Host, srsHash, srsTimestamp, srsHost, srsUser string) bool {
+	if srsHost == "" {
+		return false
+	}
+	slot, err := srs.timestampSlot(srsTimestamp)
+	if err != nil {
+		return false
+	}
+	return srs.validSignature(srsHost, srsHash, srs.hashInput0(srs1Host, srsTimestamp, srsHost, srsUser), slot)
+}
+
+// HashInput returns the string used as hash input for the email, useful for
+// debugging interop with other SRS implementations. SRS addresses at Domain are
+// treated as reversed, all other addresses as forwarded. InstanceSalt, which
+// derives HMAC key, is not included.
+func (srs *SRS) HashInput(email string) (string, error) {
+	if err := srs.setDefaults(); err != nil {
+		return "", err
+	}
+
+	local, hostname, err := parseEmail(email)
+	if err != nil {
+		return "", err
+	}
+
+	if srs.isLocalDomain(hostname) {
+		switch srs.kind(local) {
+		case KindSRS0:
+			_, srsHash, srsTimestamp, srsHost, srsUser, err := srs.parseSRS0(local)
+			if err != nil {
+				return "", err
+			}
+			tag, _ := srs.inputTag(srsHash)
+			return tagged(tag, srs.hashInput0(hostname, srsTimestamp, srsHost, srsUser)), nil
+
+		case KindSRS1:
+			srsLocal, srs1Hash, srs1Host, _, _, _, _, err := srs.parseSRS1(local)
+			if err != nil {
+				return "", err
+			}
+			tag, _ := srs.inputTag(srs1Hash)
+			return tagged(tag, srs.hashInput1(hostname, srs1Host, srsLocal)), nil
+
+		default:
+			return "", ErrNotSRS
+		}
+	}
+
+	switch srs.kind(local) {
+	case KindSRS0:
+		srsLocal, _, _, _, _, err := srs.parseSRS0(local)
+		if err != nil {
+			return "", err
+		}
+		return tagged(srs.versionTag()+srs.schemeTag(), srs.hashInput1(srs.outDomain(hostname), hostname, srsLocal)), nil
+
+	case KindSRS1:
+		srsLocal, _, srs1Host, _, _, _, _, err := srs.parseSRS1(local)
 		if err != nil {
 			return "", err
 		}
+		return tagged(srs.versionTag()+srs.schemeTag(), srs.hashInput1(srs.outDomain(hostname), srs1Host, srsLocal)), nil
 
-		if srs1Hash != srs.hash([]byte(strings.ToLower(srs1Host+srsLocal))) {
-			return "", errors.New("Hash invalid in SRS address")
+	default:
+		ts, err := srs.forwardTimestamp()
+		if err != nil {
+			return "", err
+		}
+		return tagged(srs.versionTag()+srs.schemeTag(), srs.hashInput0(srs.outDomain(hostname), ts, hostname, local)), nil
+	}
+}
+
+// TimeSlot returns decoded timestamp of SRS0 address without any validation,
+// useful for grouping addresses by day they were minted
+func (srs *SRS) TimeSlot(email string) (int, error) {
+	if err := srs.setDefaults(); err != nil {
+		return 0, err
+	}
+
+	local, _, err := parseEmail(email)
+	if err != nil {
+		return 0, err
+	}
+	if srs.kind(local) != KindSRS0 {
+		return 0, ErrNotSRS
+	}
+
+	_, _, srsTimestamp, _, _, err := srs.parseSRS0(local)
+	if err != nil {
+		return 0, err
+	}
+	slot, err := srs.timestampSlot(srsTimestamp)
+	if err != nil {
+		return 0, err
+	}
+	return srs.codec().Decode(slot)
+}
+
+// SecretIndexFor returns index of secret which signed SRS address, 0 for
+// primary secret, i+1 for SecondarySecrets[i] and len(SecondarySecrets)+i+1
+// for TimedSecrets[i] which is not primary, without timestamp check.
+// It returns -1 and ErrHashInvalid if no secret matches.
+func (srs *SRS) SecretIndexFor(email string) (int, error) {
+	if err := srs.setDefaults(); err != nil {
+		return -1, err
+	}
+
+	local, hostname, err := parseEmail(email)
+	if err != nil {
+		return -1, err
+	}
+
+	var i int
+	switch srs.kind(local) {
+	case KindSRS0:
+		_, srsHash, srsTimestamp, srsHost, srsUser, err := srs.parseSRS0(local)
+		if err != nil {
+			return -1, err
 		}
+		slot, _ := srs.timestampSlot(srsTimestamp)
+		i = srs.signatureIndex(srsHost, srsHash, srs.hashInput0(hostname, srsTimestamp, srsHost, srsUser), slot)
 
-		return "SRS0" + srsLocal + "@" + srs1Host, nil
+	case KindSRS1:
+		srsLocal, srs1Hash, srs1Host, _, _, _, _, err := srs.parseSRS1(local)
+		if err != nil {
+			return -1, err
+		}
+		i = srs.signatureIndex(srs1Host, srs1Hash, srs.hashInput1(hostname, srs1Host, srsLocal), "")
 
 	default:
-		return "", errors.New("Not an SRS address")
+		return -1, ErrNotSRS
+	}
+
+	if i == -1 {
+		return -1, ErrHashInvalid
+	}
+	return i, nil
+}
+
+// hashInput0 returns hash input of SRS0 address at addrHost
+func (srs SRS) hashInput0(addrHost, ts, host, user string) string {
+	return srs.hashCase(srs.boundHost(addrHost) + ts + srs.hashDelim() + srs.hostLength(host) + host + srs.hashDelim() + user)
+}
+
+// hashInput1 returns hash input of SRS1 address at addrHost
+func (srs SRS) hashInput1(addrHost, host, srsLocal string) string {
+	return srs.hashCase(srs.boundHost(addrHost) + srs.hostLength(host) + host + srs.hashDelim() + srsLocal)
+}
+
+// boundHost returns hash input prefix of Domain if BindForwardingDomain is set
+// and host of SRS address if BindHost is set, each followed by separator
+func (srs SRS) boundHost(addrHost string) string {
+	var bound string
+	if srs.BindForwardingDomain {
+		bound = srs.Domain + sep
+	}
+	if srs.BindHost {
+		bound += addrHost + sep
+	}
+	return bound
+}
+
+// hostLength returns byte length of host enclosed in separators, empty unless
+// BindDomainLength is set. Timestamp can't contain separator, so the length
+// is unambiguous in hash input.
+func (srs SRS) hostLength(host string) string {
+	if srs.BindDomainLength {
+		return sep + strconv.Itoa(len(host)) + sep
+	}
+	return ""
+}
+
+// hashDelim returns delimiter of hash input fields, empty unless
+// DelimitHashInput is set
+func (srs SRS) hashDelim() string {
+	if srs.DelimitHashInput {
+		return "\x00"
+	}
+	return ""
+}
+
+// hashCase returns lower-cased hash input unless CaseSensitiveHash is set
+func (srs SRS) hashCase(input string) string {
+	if srs.CaseSensitiveHash {
+		return input
+	}
+	return strings.ToLower(input)
+}
+
+// signature returns hash field for hash input of address with original domain,
+// with version digit and SchemeTag prepended to both hash field and hash input
+func (srs SRS) signature(domain, input string) string {
+	tag := srs.versionTag() + srs.schemeTag()
+	field := tag + srs.hash(srs.secret(domain), []byte(tagged(tag, input)))
+	if srs.UppercaseHash {
+		return strings.ToUpper(field)
+	}
+	return field
+}
+
+// validSignature reports whether hash field is valid for hash input of address
+// with original domain and timestamp ts, hash field must be tagged with
+// SchemeTag if set
+func (srs SRS) validSignature(domain, field, input, ts string) bool {
+	return srs.signatureIndex(domain, field, input, ts) != -1
+}
+
+// signatureIndex returns index of secret which signed hash field, 0 for
+// primary secret, i+1 for SecondarySecrets[i] and len(SecondarySecrets)+i+1
+// for TimedSecrets[i] active on the day of timestamp ts, or -1 if none did.
+// Hash field is compared case insensitive like postsrsd does, so hash emitted
+// with UppercaseHash is valid.
+func (srs SRS) signatureIndex(domain, field, input, ts string) int {
+	tag, ok := srs.inputTag(field)
+	if !ok {
+		return -1
+	}
+	in := []byte(tagged(tag, input))
+	if strings.EqualFold(field, tag+srs.hash(srs.secret(domain), in)) {
+		return 0
+	}
+	for i, secret := range srs.SecondarySecrets {
+		if strings.EqualFold(field, tag+srs.hash(secret, in)) {
+			return i + 1
+		}
+	}
+	for i, timed := range srs.TimedSecrets {
+		if srs.timedSecretCovers(i, ts) && strings.EqualFold(field, tag+srs.hash(timed.Secret, in)) {
+			return len(srs.SecondarySecrets) + i + 1
+		}
 	}
+	return -1
 }
 
-func (srs SRS) hash(input []byte) string {
-	mac := hmac.New(sha1.New, srs.Secret)
+// addChecksum appends full checksum field to SRS local part if FullChecksum is set
+func (srs SRS) addChecksum(local string) string {
+	if !srs.FullChecksum {
+		return local
+	}
+	return local + sep + srs.checksum(srs.primarySecret(), local)
+}
+
+// verifyChecksum returns SRS local part without full checksum field and
+// whether the checksum is valid for Secret or any of SecondarySecrets
+func (srs SRS) verifyChecksum(local string) (string, bool) {
+	i := strings.LastIndex(local, sep)
+	if i == -1 {
+		return "", false
+	}
+	local, sum := local[:i], local[i+len(sep):]
+	if sum == srs.checksum(srs.primarySecret(), local) {
+		return local, true
+	}
+	for _, secret := range srs.SecondarySecrets {
+		if sum == srs.checksum(secret, local) {
+			return local, true
+		}
+	}
+	for i, timed := range srs.TimedSecrets {
+		if srs.timedSecretCovers(i, "") && sum == srs.checksum(timed.Secret, local) {
+			return local, true
+		}
+	}
+	return "", false
+}
+
+// checksum returns full checksum of SRS local part
+func (srs SRS) checksum(secret []byte, local string) string {
+	return srs.hash(secret, []byte(srs.hashCase(local)))
+}
+
+// secret returns secret for original domain from SecretForDomain or primary secret
+func (srs SRS) secret(domain string) []byte {
+	if srs.SecretForDomain != nil {
+		if secret := srs.SecretForDomain(strings.ToLower(domain)); secret != nil {
+			return secret
+		}
+	}
+	return srs.primarySecret()
+}
+
+// schemeTag returns SchemeTag as string or empty string if not set
+func (srs SRS) schemeTag() string {
+	if srs.SchemeTag == 0 {
+		return ""
+	}
+	return string(srs.SchemeTag)
+}
+
+// fieldTag returns SchemeTag if hash field is tagged, or empty string
+func (srs SRS) fieldTag(field string) string {
+	if srs.SchemeTag != 0 && len(field) == srs.HashLength+1 && upperASCII(field[0]) == upperASCII(srs.SchemeTag) {
+		return srs.schemeTag()
+	}
+	return ""
+}
+
+func (srs SRS) hash(secret, input []byte) string {
+	if len(srs.InstanceSalt) > 0 {
+		// per-instance key, salt written before input could be shifted into it
+		mac := hmac.New(sha1.New, secret)
+		mac.Write(srs.InstanceSalt)
+		secret = mac.Sum(nil)
+	}
+	mac := hmac.New(sha1.New, secret)
 	mac.Write(input)
-	s := base64.StdEncoding.EncodeToString(mac.Sum(nil))
-	return s[:hashLength]
+	sum := mac.Sum(nil)
+	if srs.TruncateBeforeEncode {
+		// keep bytes covering all bits of hash, whole digest at maxHashLength
+		if n := (srs.HashLength*6 + 7) / 8; n < len(sum) {
+			sum = sum[:n]
+		}
+		return base64.RawStdEncoding.EncodeToString(sum)[:srs.HashLength]
+	}
+	s := base64.StdEncoding.EncodeToString(sum)
+	return s[:srs.HashLength]
 }
 
-// setDefaults parameters if not set
-func (srs *SRS) setDefaults() {
-	if srs.defaultsChecked {
-		return
+// Validate engine configuration, returns ErrHashTooShortConfig or
+// ErrHashTooLongConfig for bad HashLength, ErrSchemeTagConfig for bad SchemeTag
+// and ErrWeakSecret for short Secret if RequireStrongSecret is set. The same
+// error is returned by Forward and Reverse, so call Validate on startup to catch
+// misconfiguration early.
+func (srs *SRS) Validate() error {
+	return srs.setDefaults()
+}
+
+// canaries are addresses forwarded by CompatibleWith
+var canaries = []string{
+	"canary@srs-canary.invalid",
+	"SRS0=abcd=AA=srs-canary.invalid=canary@srs-canary.invalid",
+}
+
+// CompatibleWith reports whether addresses forwarded by the engine are
+// reversed by other engine and vice versa, like with partner forwarder which
+// should share the secret and hashing options. Error is returned only if
+// either engine is misconfigured.
+func (srs *SRS) CompatibleWith(other *SRS) (bool, error) {
+	if err := srs.Validate(); err != nil {
+		return false, err
+	}
+	if err := other.Validate(); err != nil {
+		return false, err
+	}
+
+	// copies without Store and Lookup, and unexported methods which skip
+	// cache and Stats, so canaries don't show up in operator's data
+	a, b := *srs, *other
+	a.Store, a.Lookup = nil, nil
+	b.Store, b.Lookup = nil, nil
+	for _, pair := range [][2]*SRS{{&a, &b}, {&b, &a}} {
+		for _, canary := range canaries {
+			fwd, err := pair[0].forward(canary)
+			if err != nil {
+				return false, nil
+			}
+			rvs, _, err := pair[1].reverseAddress(fwd, 0)
+			if err != nil || !strings.EqualFold(rvs, canary) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// Warmup initializes engine defaults, stats and cache, and returns
+// configuration error like Validate. Call it on server startup, so the first
+// request doesn't pay for initialization.
+func (srs *SRS) Warmup() error {
+	return srs.setDefaults()
+}
+
+// defaultsMu serializes the first setDefaults of engines, so concurrent first
+// calls wait for initialization like with sync.Once, which can't be a field
+// since engine is copied by value
+var defaultsMu sync.Mutex
+
+// setDefaults parameters if not set and return configuration error if any
+func (srs *SRS) setDefaults() error {
+	if atomic.LoadUint32(&srs.defaultsDone) == 1 {
+		return srs.defaultsErr
+	}
+
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	if srs.defaultsDone == 0 {
+		srs.initDefaults()
+		atomic.StoreUint32(&srs.defaultsDone, 1)
+	}
+	return srs.defaultsErr
+}
+
+// initDefaults sets parameters which are not set, allocates stats and cache
+// and sets configuration error if any
+func (srs *SRS) initDefaults() {
+	srs.stats = &counters{}
+	if srs.CacheSize > 0 {
+		srs.cache = newLRUCache(srs.CacheSize)
+	} else {
+		srs.last = newLRUCache(1)
+	}
+
+	if strings.ContainsRune(srs.Domain, '@') || strings.IndexFunc(srs.Domain, unicode.IsSpace) != -1 {
+		srs.defaultsErr = ErrInvalidDomain
+	}
+
+	if (srs.NormalizeUnicode || srs.IDNA) && !unicodeSupported {
+		srs.defaultsErr = ErrUnicodeConfig
+	}
+
+	if err := srs.applyCompatibility(); err != nil {
+		srs.defaultsErr = err
 	}
 
 	switch srs.FirstSeparator {
@@ -209,58 +1646,221 @@ func (srs *SRS) setDefaults() {
 		srs.FirstSeparator = "="
 	}
 
-	srs.defaultsChecked = true
-}
+	if srs.Prefixes.SRS0 == "" {
+		srs.Prefixes.SRS0 = "SRS0"
+	}
+	if srs.Prefixes.SRS1 == "" {
+		srs.Prefixes.SRS1 = "SRS1"
+	}
+	srs.srs0Len = len(srs.Prefixes.SRS0) + firstSepLen
+	srs.srs1Len = len(srs.Prefixes.SRS1) + firstSepLen
 
-// parseEmail and return username and domain name
-func parseEmail(e string) (user, domain string, err error) {
-	if !strings.ContainsRune(e, '@') {
-		return "", "", errors.New("No at sign in sender address") // compatibility with postsrsd error message
+	if srs.MaxInputLength == 0 {
+		srs.MaxInputLength = maxInput
 	}
 
-	addr, err := mail.ParseAddress(e)
-	if err != nil {
-		return "", "", errors.New("Bad formated email address")
+	switch {
+	case srs.HashLength == 0:
+		srs.HashLength = hashLength
+	case srs.HashLength < minHashLength:
+		srs.defaultsErr = ErrHashTooShortConfig
+	case srs.HashLength > maxHashLength:
+		srs.defaultsErr = ErrHashTooLongConfig
 	}
-	parts := strings.SplitN(addr.Address, "@", 2)
-	if len(parts) != 2 {
-		return "", "", errors.New("No at sign in sender address")
 
+	if srs.TimeSlots < 0 || srs.TimeSlots > int(timeSlots) {
+		srs.defaultsErr = ErrTimeSlotsConfig
+	} else if srs.MaxAge >= srs.slots() || srs.MaxAge == 0 && maxAge >= srs.slots() {
+		srs.defaultsErr = ErrMaxAgeConfig
 	}
-	return parts[0], parts[1], nil
+	for _, slots := range srs.LegacyTimeSlots {
+		if slots < 1 || slots > int(timeSlots) {
+			srs.defaultsErr = ErrTimeSlotsConfig
+		}
+	}
+
+	if srs.Version < 0 || srs.Version > maxVersion {
+		srs.defaultsErr = ErrVersionConfig
+	}
+
+	if srs.FieldLayout != LayoutStandard && srs.FieldLayout != LayoutTimestampFirst {
+		srs.defaultsErr = ErrFieldLayoutConfig
+	}
+
+	if c := srs.SchemeTag; c != 0 && !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9') {
+		srs.defaultsErr = ErrSchemeTagConfig
+	}
+
+	if len(srs.MasterSecret) > 0 {
+		if len(srs.Secret) > 0 {
+			srs.defaultsErr = ErrSecretConfig
+		} else {
+			srs.Secret = hkdfSHA256(srs.MasterSecret, srs.Info, derivedKeyLen)
+		}
+	}
+
+	if srs.RequireStrongSecret && srs.defaultsErr == nil {
+		srs.defaultsErr = srs.CheckSecretStrength()
+	}
+}
+
+// now returns current time from NowFunc or time.Now
+func (srs SRS) now() time.Time {
+	if srs.NowFunc != nil {
+		return srs.NowFunc()
+	}
+	return time.Now()
+}
+
+// slots returns number of days in timestamp cycle
+func (srs SRS) slots() int {
+	if srs.TimeSlots > 0 {
+		return srs.TimeSlots
+	}
+	return int(timeSlots)
 }
 
 // timestamp integer
-func timestamp() int {
-	t := float64(time.Now().Unix())
-	x := math.Mod(t/timePrecision, timeSlots)
-	return int(x)
+func (srs SRS) timestamp() (int, error) {
+	return srs.timestampIn(srs.slots())
 }
 
-// checkTimestamp validity for illegal characters and out of date timestamp
-func (srs *SRS) checkTimestamp(ts string) error {
-	// decode base32 encoded timestamp to `then``
-	then := 0
-	for _, c := range ts {
-		pos := strings.IndexRune(base32, unicode.ToUpper(c))
-		if pos == -1 {
-			return errors.New("Bad base32 character in timestamp")
+// timestampIn returns timestamp integer in cycle of slots days
+func (srs SRS) timestampIn(slots int) (int, error) {
+	now := srs.now()
+	if now.IsZero() {
+		return 0, ErrInvalidNow
+	}
+	// floor and normalize, so days before epoch are in the previous cycle
+	days := math.Floor(float64(now.Unix()-srs.epoch()) / timePrecision)
+	x := math.Mod(days, float64(slots))
+	if x < 0 {
+		x += float64(slots)
+	}
+	return int(x), nil
+}
+
+// epoch returns TimeEpoch or Unix epoch as Unix time
+func (srs SRS) epoch() int64 {
+	if srs.TimeEpoch.IsZero() {
+		return 0
+	}
+	return srs.TimeEpoch.Unix()
+}
+
+// maxAgeFor returns max age in days of SRS address with original host
+func (srs SRS) maxAgeFor(host string) int {
+	if srs.MaxAgeForDomain != nil {
+		if age := srs.MaxAgeForDomain(host); age > 0 {
+			return age
 		}
-		then = then<<5 | pos
+	}
+	if srs.MaxAge > 0 {
+		return srs.MaxAge
+	}
+	return maxAge
+}
+
+// checkTimestamp validity for illegal characters and out of date timestamp of
+// address with original host, timestamp older than max age by up to grace days
+// is reported as expired. LegacyTimeSlots are tried if TimeSlots rejects it.
+func (srs *SRS) checkTimestamp(ts, host string, grace int) (expired bool, err error) {
+	expired, err = srs.checkTimestampIn(ts, host, grace, srs.slots())
+	if err != ErrTimestampExpired {
+		return expired, err
+	}
+	for _, slots := range srs.LegacyTimeSlots {
+		if legacyExpired, legacyErr := srs.checkTimestampIn(ts, host, grace, slots); legacyErr == nil {
+			return legacyExpired, nil
+		}
+	}
+	return expired, err
+}
+
+// checkTimestampIn checks timestamp like checkTimestamp in cycle of slots days
+func (srs *SRS) checkTimestampIn(ts, host string, grace, slots int) (expired bool, err error) {
+	age, err := srs.timestampAgeIn(ts, slots)
+	if err != nil {
+		return false, err
 	}
 
-	now := timestamp()
+	maxAge := srs.maxAgeFor(host)
+	switch {
+	case age <= maxAge:
+		return false, nil
+	case age <= maxAge+grace:
+		return true, nil
+	}
+
+	return false, ErrTimestampExpired
+}
+
+// timestampAge returns age of timestamp in days
+func (srs SRS) timestampAge(ts string) (int, error) {
+	return srs.timestampAgeIn(ts, srs.slots())
+}
+
+// timestampAgeIn returns age of timestamp in days in cycle of slots days
+func (srs SRS) timestampAgeIn(ts string, slots int) (int, error) {
+	then, err := srs.codec().Decode(ts)
+	if err != nil {
+		return 0, err
+	}
+	if then < 0 {
+		return 0, ErrTimestampInvalidBase32
+	}
+	if then >= slots {
+		// minted in longer cycle
+		return 0, ErrTimestampExpired
+	}
 
-	// mind the cycle of time slots
-	for now < then {
-		now = now + int(timeSlots)
+	now, err := srs.timestampIn(slots)
+	if err != nil {
+		return 0, err
 	}
 
-	if now <= then+maxAge {
-		return nil
+	// mind the cycle of time slots, timestamp ahead of now is from previous cycle
+	age := now - then
+	if then > now {
+		age = slots - (then - now)
 	}
+	return age, nil
+}
 
-	return errors.New("Time stamp out of date")
+// slotDuration is duration of time slot
+const slotDuration = time.Duration(timePrecision) * time.Second
+
+// slotStart returns start time of current time slot
+func (srs SRS) slotStart() time.Time {
+	now := srs.now()
+	elapsed := (now.Unix() - srs.epoch()) % int64(timePrecision)
+	if elapsed < 0 {
+		elapsed += int64(timePrecision)
+	}
+	return time.Unix(now.Unix()-elapsed, 0)
+}
+
+// defaultNearExpiry is threshold of OnNearExpiry if NearExpiry is not set
+const defaultNearExpiry = 24 * time.Hour
+
+// notifyNearExpiry calls OnNearExpiry if valid address with timestamp and
+// original host expires within NearExpiry
+func (srs SRS) notifyNearExpiry(email, ts, host string) {
+	age, err := srs.timestampAge(ts)
+	if err != nil {
+		return
+	}
+	// address expires at the end of time slot max age days after timestamp
+	end := srs.slotStart().Add(time.Duration(srs.maxAgeFor(host)-age+1) * slotDuration)
+	remaining := end.Sub(srs.now())
+
+	threshold := srs.NearExpiry
+	if threshold == 0 {
+		threshold = defaultNearExpiry
+	}
+	if remaining <= threshold {
+		srs.OnNearExpiry(email, remaining)
+	}
 }
 
 const (
@@ -268,8 +1868,29 @@ const (
 	baseSize = 32
 )
 
-// base32Encode integer to string
+// Base32Decode decodes base32 encoded SRS timestamp, case insensitive.
+// Timestamps longer than 2 characters are rejected, since they can't be
+// minted for 1024 time slots and would overflow int.
+func Base32Decode(s string) (int, error) {
+	if len(s) > maxTsLength {
+		return 0, ErrTimestampInvalidBase32
+	}
+	x := 0
+	for _, c := range s {
+		pos := strings.IndexRune(base32, unicode.ToUpper(c))
+		if pos == -1 {
+			return 0, ErrTimestampInvalidBase32
+		}
+		x = x<<5 | pos
+	}
+	return x, nil
+}
+
+// base32Encode integer to string, 0 is encoded as A so timestamp is never empty
 func base32Encode(x int) (encoded string) {
+	if x == 0 {
+		return base32[:1]
+	}
 	for x > 0 {
 		r := x % baseSize
 		x /= baseSize
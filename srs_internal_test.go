@@ -0,0 +1,97 @@
+package srs
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+// slotTime returns time within timestamp slot
+func slotTime(slot int) time.Time {
+	return time.Unix(int64(slot)*int64(timePrecision)+3600, 0)
+}
+
+// checkTimestampLoop is the reference implementation of timestamp cycle handling
+func checkTimestampLoop(now, then, grace int) (bool, error) {
+	for now < then {
+		now = now + int(timeSlots)
+	}
+	switch {
+	case now <= then+maxAge:
+		return false, nil
+	case now <= then+maxAge+grace:
+		return true, nil
+	}
+	return false, ErrTimestampExpired
+}
+
+func TestCheckTimestampCycle(t *testing.T) {
+	for now := 0; now < int(timeSlots); now += 7 {
+		srs := SRS{NowFunc: func() time.Time { return slotTime(now) }}
+		if ts, err := srs.timestamp(); ts != now || err != nil {
+			t.Fatalf("timestamp: expected %d, got %d %v", now, ts, err)
+		}
+		for then := 0; then < int(timeSlots); then++ {
+			expired, err := srs.checkTimestamp(base32Encode(then), "", 7)
+			expectedExpired, expectedErr := checkTimestampLoop(now, then, 7)
+			if expired != expectedExpired || err != expectedErr {
+				t.Fatalf("checkTimestamp now %d then %d: expected %v %v, got %v %v", now, then, expectedExpired, expectedErr, expired, err)
+			}
+		}
+	}
+}
+
+func TestCheckTimestampWrap(t *testing.T) {
+	srs := SRS{NowFunc: func() time.Time { return slotTime(3) }}
+	for _, tc := range []struct {
+		then int
+		err  error
+	}{
+		{3, nil},
+		{0, nil},
+		{1020, nil}, // 7 days ago in previous cycle
+		{1006, nil}, // 21 days ago in previous cycle
+		{1005, ErrTimestampExpired},
+		{1000, ErrTimestampExpired},
+		{4, ErrTimestampExpired},                 // one day ahead is 1023 days old
+		{1024 + 1020, ErrTimestampInvalidBase32}, // too long to be minted
+		{1<<20 + 1000, ErrTimestampInvalidBase32},
+	} {
+		if _, err := srs.checkTimestamp(base32Encode(tc.then), "", 0); err != tc.err {
+			t.Errorf("checkTimestamp %d: expected %v, got %v", tc.then, tc.err, err)
+		}
+	}
+}
+
+func BenchmarkCheckTimestamp(b *testing.B) {
+	srs := SRS{NowFunc: func() time.Time { return slotTime(3) }}
+	ts := base32Encode(1020) // timestamp from previous cycle
+	for i := 0; i < b.N; i++ {
+		srs.checkTimestamp(ts, "", 0)
+	}
+}
+
+func TestHKDFSHA256(t *testing.T) {
+	// RFC 5869 test case 3
+	master := make([]byte, 22)
+	for i := range master {
+		master[i] = 0x0b
+	}
+	expected := "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8"
+	if key := hex.EncodeToString(hkdfSHA256(master, nil, 42)); key != expected {
+		t.Errorf("hkdfSHA256: expected %s, got %s", expected, key)
+	}
+}
+
+func TestTruncateMaxHashLength(t *testing.T) {
+	srs := SRS{HashLength: maxHashLength, TruncateBeforeEncode: true}
+	mac := hmac.New(sha1.New, []byte("secret"))
+	mac.Write([]byte("input"))
+	expected := base64.RawStdEncoding.EncodeToString(mac.Sum(nil))
+	if hash := srs.hash([]byte("secret"), []byte("input")); hash != expected {
+		t.Errorf("hash: expected %s, got %s", expected, hash)
+	}
+}
@@ -2,12 +2,21 @@ package srs_test
 
 import (
 	"bufio"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"math/rand"
 	"net"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
+	"testing/quick"
+	"time"
 
 	"github.com/mileusna/srs"
 )
@@ -189,3 +198,2974 @@ func postsrs(port string) func(email string) (code int, fwd string) {
 		return code, msgParts[1]
 	}
 }
+
+func TestPrefixes(t *testing.T) {
+	s := srs.SRS{
+		Secret:   []byte(secret),
+		Domain:   localdomain,
+		Prefixes: srs.Prefixes{SRS0: "SRS2", SRS1: "SRS3"},
+	}
+
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(fwd, "SRS2=") {
+		t.Errorf("Forward: expected SRS2= prefix, got %s", fwd)
+	}
+	rvs, err := s.Reverse(fwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rvs != "milos@mailspot.com" {
+		t.Errorf("Reverse: expected milos@mailspot.com, got %s", rvs)
+	}
+
+	// foreign SRS2 address is rewritten to SRS3 and reversed back to SRS2
+	foreign := "SRS2=8Zzm=IS=netmark.rs=milos@domain.com"
+	fwd, err = s.Forward(foreign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(fwd, "SRS3=") {
+		t.Errorf("Forward: expected SRS3= prefix, got %s", fwd)
+	}
+	rvs, err = s.Reverse(fwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rvs != foreign {
+		t.Errorf("Reverse: expected %s, got %s", foreign, rvs)
+	}
+
+	// standard prefixes are not recognized by engine with custom prefixes
+	if _, err := s.Reverse("SRS0=8Zzm=IS=netmark.rs=milos@" + localdomain); err == nil {
+		t.Error("Reverse: expected error for SRS0 address with custom prefixes")
+	}
+}
+
+func TestPrefixLength(t *testing.T) {
+	// standard prefix, SRS1 rewrite and reverse don't depend on timestamp
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	fwd, err := s.Forward("SRS0=8Zzm=IS=netmark.rs=milos@domain.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "SRS1=50B9=domain.com==8Zzm=IS=netmark.rs=milos@" + localdomain; fwd != expected {
+		t.Errorf("Forward: expected %s, got %s", expected, fwd)
+	}
+	rvs, err := s.Reverse(fwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "SRS0=8Zzm=IS=netmark.rs=milos@domain.com"; rvs != expected {
+		t.Errorf("Reverse: expected %s, got %s", expected, rvs)
+	}
+
+	// prefixes of different length
+	s = srs.SRS{
+		Secret:   []byte(secret),
+		Domain:   localdomain,
+		Prefixes: srs.Prefixes{SRS0: "LEGACY0", SRS1: "L1"},
+	}
+	fwd, err = s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rvs, err := s.Reverse(fwd); err != nil || rvs != "milos@mailspot.com" {
+		t.Errorf("Reverse %s: expected milos@mailspot.com, got %s %v", fwd, rvs, err)
+	}
+
+	foreign := "LEGACY0-8Zzm=IS=netmark.rs=milos@domain.com"
+	fwd, err = s.Forward(foreign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(fwd, "L1=") || !strings.Contains(fwd, "=domain.com=-8Zzm=") {
+		t.Errorf("Forward: unexpected SRS1 address %s", fwd)
+	}
+	if rvs, err := s.Reverse(fwd); err != nil || rvs != foreign {
+		t.Errorf("Reverse %s: expected %s, got %s %v", fwd, foreign, rvs, err)
+	}
+}
+
+func TestStoreLookup(t *testing.T) {
+	db := make(map[string]string)
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+		Store: func(srsLocal, original string) {
+			db[srsLocal] = original
+		},
+		Lookup: func(srsLocal string) (string, bool) {
+			original, ok := db[srsLocal]
+			return original, ok
+		},
+	}
+
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srsLocal := strings.TrimSuffix(fwd, "@"+localdomain)
+	if db[srsLocal] != "milos@mailspot.com" {
+		t.Errorf("Store: expected %s to be stored for %s, got %q", "milos@mailspot.com", srsLocal, db[srsLocal])
+	}
+
+	fwd, err = s.Forward("SRS0=8Zzm=IS=netmark.rs=milos@domain.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if original := db["SRS1=50B9=domain.com==8Zzm=IS=netmark.rs=milos"]; original != "SRS0=8Zzm=IS=netmark.rs=milos@domain.com" {
+		t.Errorf("Store: unexpected original for SRS1 address %s: %q", fwd, original)
+	}
+
+	// local domain is not rewritten so nothing is stored
+	if _, err := s.Forward("milos@" + localdomain); err != nil {
+		t.Fatal(err)
+	}
+	if len(db) != 2 {
+		t.Errorf("Store: expected 2 stored addresses, got %d", len(db))
+	}
+
+	// address with invalid hash is resolved by lookup
+	db["SRS0=XXXX=IS=netmark.rs=milos"] = "milos@netmark.rs"
+	rvs, err := s.Reverse("SRS0=XXXX=IS=netmark.rs=milos@" + localdomain)
+	if err != nil || rvs != "milos@netmark.rs" {
+		t.Errorf("Lookup: expected milos@netmark.rs, got %s %v", rvs, err)
+	}
+	if _, err := s.Reverse("SRS0=YYYY=IS=netmark.rs=milos@" + localdomain); err == nil {
+		t.Error("Lookup: expected error for unknown address with invalid hash")
+	}
+}
+
+func TestURLDecodeInput(t *testing.T) {
+	s := srs.SRS{
+		Secret:         []byte(secret),
+		Domain:         localdomain,
+		URLDecodeInput: true,
+	}
+
+	fwd, err := s.Forward("hello+world@domain.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, encoded := range []string{
+		fwd,
+		strings.Replace(fwd, "=", "%3D", -1),
+		strings.Replace(strings.Replace(fwd, "=", "%3d", -1), "@", "%40", -1),
+	} {
+		rvs, err := s.Reverse(encoded)
+		if err != nil || rvs != "hello+world@domain.com" {
+			t.Errorf("Reverse %s: expected hello+world@domain.com, got %s %v", encoded, rvs, err)
+		}
+	}
+
+	// plus sign is literal SRS separator, not a space
+	s.FirstSeparator = "+"
+	fwd, err = s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := strings.Replace(fwd, "=", "%3D", -1)
+	if !strings.HasPrefix(encoded, "SRS0+") {
+		t.Fatalf("Forward: expected SRS0+ prefix, got %s", fwd)
+	}
+	if rvs, err := s.Reverse(encoded); err != nil || rvs != "milos@mailspot.com" {
+		t.Errorf("Reverse %s: expected milos@mailspot.com, got %s %v", encoded, rvs, err)
+	}
+
+	if _, err := s.Reverse("SRS0%3Z" + fwd[5:]); err == nil {
+		t.Error("Reverse: expected error for bad URL encoding")
+	}
+
+	// without the option encoded address is not an SRS address
+	s.URLDecodeInput = false
+	if _, err := s.Reverse(encoded); err == nil {
+		t.Error("Reverse: expected error for encoded address without URLDecodeInput")
+	}
+}
+
+func TestInvalidDomain(t *testing.T) {
+	for _, tc := range []struct {
+		domain string
+		err    error
+	}{
+		{"user@example.com", srs.ErrInvalidDomain},
+		{"@example.com", srs.ErrInvalidDomain},
+		{"example .com", srs.ErrInvalidDomain},
+		{"example.com\n", srs.ErrInvalidDomain},
+		{"\texample.com", srs.ErrInvalidDomain},
+		{"example.com", nil},
+		{localdomain, nil},
+	} {
+		s := srs.SRS{Secret: []byte(secret), Domain: tc.domain}
+		if err := s.Validate(); err != tc.err {
+			t.Errorf("Validate Domain %q: expected %v, got %v", tc.domain, tc.err, err)
+		}
+		if _, err := s.Forward("milos@mailspot.com"); err != tc.err {
+			t.Errorf("Forward with Domain %q: expected %v, got %v", tc.domain, tc.err, err)
+		}
+	}
+}
+
+func TestHashLength(t *testing.T) {
+	for _, tc := range []struct {
+		length int
+		err    error
+	}{
+		{1, srs.ErrHashTooShortConfig},
+		{2, srs.ErrHashTooShortConfig},
+		{3, nil},
+		{4, nil},
+		{28, srs.ErrHashTooLongConfig},
+	} {
+		s := srs.SRS{
+			Secret:     []byte(secret),
+			Domain:     localdomain,
+			HashLength: tc.length,
+		}
+		if err := s.Validate(); err != tc.err {
+			t.Errorf("Validate HashLength %d: expected %v, got %v", tc.length, tc.err, err)
+		}
+
+		fwd, err := s.Forward("milos@mailspot.com")
+		if err != tc.err {
+			t.Errorf("Forward HashLength %d: expected %v, got %v", tc.length, tc.err, err)
+		}
+		if err != nil {
+			if _, err := s.Reverse("SRS0=XXXX=IS=netmark.rs=milos@" + localdomain); err != tc.err {
+				t.Errorf("Reverse HashLength %d: expected %v, got %v", tc.length, tc.err, err)
+			}
+			continue
+		}
+
+		if hash := strings.SplitN(fwd, "=", 3)[1]; len(hash) != tc.length {
+			t.Errorf("Forward HashLength %d: unexpected hash %s in %s", tc.length, hash, fwd)
+		}
+		if rvs, err := s.Reverse(fwd); err != nil || rvs != "milos@mailspot.com" {
+			t.Errorf("Reverse HashLength %d: expected milos@mailspot.com, got %s %v", tc.length, rvs, err)
+		}
+	}
+}
+
+func TestReverseHeader(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, header := range []string{
+		fwd,
+		"<" + fwd + ">",
+		"Return-Path: <" + fwd + ">",
+		"return-path:<" + fwd + ">\r\n",
+		"  Return-Path: " + fwd,
+	} {
+		rvs, err := s.ReverseHeader(header)
+		if err != nil || rvs != "milos@mailspot.com" {
+			t.Errorf("ReverseHeader %q: expected milos@mailspot.com, got %s %v", header, rvs, err)
+		}
+	}
+
+	for _, header := range []string{
+		"Return-Path: <>",
+		"Return-Path: <milos@mailspot.com>",
+		"<" + fwd,
+	} {
+		if rvs, err := s.ReverseHeader(header); err == nil {
+			t.Errorf("ReverseHeader %q: expected error, got %s", header, rvs)
+		}
+	}
+}
+
+// address is random valid email address generated for property tests
+type address string
+
+const (
+	localChars  = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!#$%&'*+/=?^_`{|}~-"
+	domainChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// Generate dot-atom local part starting with lower case letter, so it is never
+// an SRS address itself, and domain of one to three labels
+func (address) Generate(r *rand.Rand, size int) reflect.Value {
+	randString := func(chars string, n int) string {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = chars[r.Intn(len(chars))]
+		}
+		return string(b)
+	}
+
+	local := randString(domainChars[:26], 1) + randString(localChars, r.Intn(size+1))
+	if r.Intn(2) == 0 {
+		local += "." + randString(localChars, 1+r.Intn(size+1))
+	}
+
+	labels := make([]string, 1+r.Intn(3))
+	for i := range labels {
+		labels[i] = randString(domainChars, 1+r.Intn(size+1))
+		if n := len(labels[i]); n > 2 && r.Intn(2) == 0 {
+			labels[i] = labels[i][:1] + "-" + labels[i][2:]
+		}
+	}
+	return reflect.ValueOf(address(local + "@" + strings.Join(labels, ".")))
+}
+
+func TestRoundTripQuick(t *testing.T) {
+	now := time.Date(2021, 3, 14, 15, 9, 26, 0, time.UTC)
+	s := srs.SRS{
+		Secret:  []byte(secret),
+		Domain:  localdomain,
+		NowFunc: func() time.Time { return now },
+	}
+	foreign := srs.SRS{
+		Secret:  []byte("foreign secret"),
+		Domain:  "foreign.example.com",
+		NowFunc: s.NowFunc,
+	}
+
+	// Reverse(Forward(x)) == x
+	srs0 := func(a address) bool {
+		fwd, err := s.Forward(string(a))
+		if err != nil {
+			t.Logf("Forward %s: %v", a, err)
+			return false
+		}
+		rvs, err := s.Reverse(fwd)
+		if err != nil || rvs != string(a) {
+			t.Logf("Reverse %s: expected %s, got %s %v", fwd, a, rvs, err)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(srs0, nil); err != nil {
+		t.Error(err)
+	}
+
+	// foreign SRS0 is rewritten to SRS1 and reversed back to foreign SRS0
+	srs1 := func(a address) bool {
+		srs0, err := foreign.Forward(string(a))
+		if err != nil {
+			t.Logf("Forward %s: %v", a, err)
+			return false
+		}
+		fwd, err := s.Forward(srs0)
+		if err != nil {
+			t.Logf("Forward %s: %v", srs0, err)
+			return false
+		}
+		rvs, err := s.Reverse(fwd)
+		if err != nil || rvs != srs0 {
+			t.Logf("Reverse %s: expected %s, got %s %v", fwd, srs0, rvs, err)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(srs1, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReverseGraceful(t *testing.T) {
+	minted := time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC)
+	now := minted
+	s := srs.SRS{
+		Secret:      []byte(secret),
+		Domain:      localdomain,
+		GracePeriod: 7,
+		NowFunc:     func() time.Time { return now },
+	}
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		days    int
+		expired bool
+		err     error
+	}{
+		{0, false, nil},
+		{5, false, nil},
+		{21, false, nil},
+		{22, true, nil},
+		{28, true, nil},
+		{29, false, srs.ErrTimestampExpired},
+		{40, false, srs.ErrTimestampExpired},
+	} {
+		now = minted.AddDate(0, 0, tc.days)
+		rvs, expired, err := s.ReverseGraceful(fwd)
+		if err != tc.err || expired != tc.expired {
+			t.Errorf("ReverseGraceful after %d days: expected %v %v, got %v %v", tc.days, tc.expired, tc.err, expired, err)
+			continue
+		}
+		if err == nil && rvs != "milos@mailspot.com" {
+			t.Errorf("ReverseGraceful after %d days: expected milos@mailspot.com, got %s", tc.days, rvs)
+		}
+
+		// Reverse doesn't accept expired addresses within grace period
+		if _, err := s.Reverse(fwd); (err == nil) != (!tc.expired && tc.err == nil) {
+			t.Errorf("Reverse after %d days: unexpected error %v", tc.days, err)
+		}
+	}
+
+	// hash is still validated within grace period
+	now = minted.AddDate(0, 0, 25)
+	if _, _, err := s.ReverseGraceful("SRS0=XXXX" + fwd[9:]); err != srs.ErrHashInvalid {
+		t.Errorf("ReverseGraceful: expected %v, got %v", srs.ErrHashInvalid, err)
+	}
+}
+
+func TestMailSRSInterop(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+
+	// SRS1 separator after host is followed by SRS0 first separator
+	for _, tc := range []struct {
+		srs0     string
+		compound string
+	}{
+		{"SRS0=8Zzm=IS=netmark.rs=milos@domain.com", "=="},
+		{"SRS0+8Zzm=IS=netmark.rs=milos@domain.com", "=+"},
+		{"SRS0-8Zzm=IS=netmark.rs=milos@domain.com", "=-"},
+	} {
+		fwd, err := s.Forward(tc.srs0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(fwd, "=domain.com"+tc.compound+"8Zzm=") {
+			t.Errorf("Forward %s: expected %s after host, got %s", tc.srs0, tc.compound, fwd)
+		}
+		if rvs, err := s.Reverse(fwd); err != nil || rvs != tc.srs0 {
+			t.Errorf("Reverse %s: expected %s, got %s %v", fwd, tc.srs0, rvs, err)
+		}
+	}
+
+	// SRS1 generated by Mail::SRS is rewritten with SRS0 separator preserved
+	for _, tc := range []struct {
+		srs1 string
+		srs0 string
+	}{
+		{"SRS1=omnM=domain.com==8Znm=IC=netmark.rs=milos@mailsrs.net", "SRS0=8Znm=IC=netmark.rs=milos@domain.com"},
+		{"SRS1=omnM=domain.com=+8Znm=IC=netmark.rs=milos@mailsrs.net", "SRS0+8Znm=IC=netmark.rs=milos@domain.com"},
+		{"SRS1=omnM=domain.com=-8Znm=IC=netmark.rs=milos@mailsrs.net", "SRS0-8Znm=IC=netmark.rs=milos@domain.com"},
+		{"SRS1=JIBX=thirddomain.com==opaque+string@mailsrs.net", "SRS0=opaque+string@thirddomain.com"},
+	} {
+		fwd, err := s.Forward(tc.srs1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rvs, err := s.Reverse(fwd); err != nil || rvs != tc.srs0 {
+			t.Errorf("Reverse %s: expected %s, got %s %v", fwd, tc.srs0, rvs, err)
+		}
+	}
+
+	// SRS1 with single separator after host is accepted in lenient mode only
+	single := "SRS1=omnM=domain.com=8Znm=IC=netmark.rs=milos@mailsrs.net"
+	if _, err := s.Forward(single); err != srs.ErrNoUserSRS1 {
+		t.Errorf("Forward %s: expected %v, got %v", single, srs.ErrNoUserSRS1, err)
+	}
+	s.Lenient = true
+	fwd, err := s.Forward(single)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(fwd, "=domain.com==8Znm=") {
+		t.Errorf("Forward %s: expected compound separator, got %s", single, fwd)
+	}
+	if rvs, err := s.Reverse(fwd); err != nil || rvs != "SRS0=8Znm=IC=netmark.rs=milos@domain.com" {
+		t.Errorf("Reverse %s: expected SRS0=8Znm=IC=netmark.rs=milos@domain.com, got %s %v", fwd, rvs, err)
+	}
+}
+
+func TestHashInput(t *testing.T) {
+	s := srs.SRS{
+		Secret:  []byte(secret),
+		Domain:  localdomain,
+		NowFunc: func() time.Time { return time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC) },
+	}
+
+	fwd, err := s.Forward("Milos@MailSpot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := strings.Split(fwd, "=")[2]
+
+	for _, tc := range []struct {
+		email string
+		input string
+	}{
+		{"Milos@MailSpot.com", strings.ToLower(ts) + "mailspot.commilos"},
+		{fwd, strings.ToLower(ts) + "mailspot.commilos"},
+		{"SRS0=8Zzm=IS=netmark.rs=milos@domain.com", "domain.com=8zzm=is=netmark.rs=milos"},
+		{"SRS0+8Zzm=IS=netmark.rs=milos@domain.com", "domain.com+8zzm=is=netmark.rs=milos"},
+		{"SRS1=50B9=domain.com==8Zzm=IS=netmark.rs=milos@" + localdomain, "domain.com=8zzm=is=netmark.rs=milos"},
+		{"SRS1=50B9=domain.com==8Zzm=IS=netmark.rs=milos@other.com", "domain.com=8zzm=is=netmark.rs=milos"},
+		{"SRS0=XXXX=IS=Netmark.rs=Milos@" + localdomain, "isnetmark.rsmilos"},
+	} {
+		input, err := s.HashInput(tc.email)
+		if err != nil || input != tc.input {
+			t.Errorf("HashInput %s: expected %s, got %s %v", tc.email, tc.input, input, err)
+		}
+	}
+
+	if _, err := s.HashInput("milos@" + localdomain); err != srs.ErrNotSRS {
+		t.Errorf("HashInput: expected %v, got %v", srs.ErrNotSRS, err)
+	}
+}
+
+func TestForwardWithORCPT(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+
+	sender := "sender@example.com"
+	for _, tc := range []struct {
+		rcpt  string
+		orcpt string
+	}{
+		{"milos@mailspot.com", "rfc822;milos@mailspot.com"},
+		{"hello+world@domain.com", "rfc822;hello+2Bworld@domain.com"},
+		{"a=b@domain.com", "rfc822;a+3Db@domain.com"},
+		{"miloš@domain.com", "rfc822;milo+C5+A1@domain.com"},
+		{"SRS0=8Zzm=IS=netmark.rs=milos@domain.com", "rfc822;SRS0+3D8Zzm+3DIS+3Dnetmark.rs+3Dmilos@domain.com"},
+	} {
+		fwd, orcpt, err := s.ForwardWithORCPT(sender, tc.rcpt)
+		if err != nil {
+			t.Errorf("ForwardWithORCPT %s: %v", tc.rcpt, err)
+			continue
+		}
+		if orcpt != tc.orcpt {
+			t.Errorf("ForwardWithORCPT %s: expected %s, got %s", tc.rcpt, tc.orcpt, orcpt)
+		}
+		if expected, _ := s.Forward(sender); fwd != expected {
+			t.Errorf("ForwardWithORCPT %s: expected %s, got %s", sender, expected, fwd)
+		}
+	}
+
+	if _, _, err := s.ForwardWithORCPT(sender, "milos"); err != srs.ErrNoAtSign {
+		t.Errorf("ForwardWithORCPT bad recipient: expected %v, got %v", srs.ErrNoAtSign, err)
+	}
+	if _, _, err := s.ForwardWithORCPT("milos", "milos@mailspot.com"); err != srs.ErrNoAtSign {
+		t.Errorf("ForwardWithORCPT bad sender: expected %v, got %v", srs.ErrNoAtSign, err)
+	}
+}
+
+func TestBarePrefixLocalPart(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+
+	for _, email := range []string{
+		"SRS0@other.com",
+		"SRS1@other.com",
+		"srs0@other.com",
+		"SRS0x@other.com",
+		"SRS1.x@other.com",
+	} {
+		fwd, err := s.Forward(email)
+		if err != nil {
+			t.Errorf("Forward %s: %v", email, err)
+			continue
+		}
+		if !strings.HasPrefix(fwd, "SRS0=") || !strings.HasSuffix(fwd, "=other.com="+strings.Split(email, "@")[0]+"@"+localdomain) {
+			t.Errorf("Forward %s: expected regular SRS0 rewrite, got %s", email, fwd)
+		}
+		if rvs, err := s.Reverse(fwd); err != nil || rvs != email {
+			t.Errorf("Reverse %s: expected %s, got %s %v", fwd, email, rvs, err)
+		}
+		if _, err := s.Reverse(email); err != srs.ErrNotSRS {
+			t.Errorf("Reverse %s: expected %v, got %v", email, srs.ErrNotSRS, err)
+		}
+	}
+
+	// prefix with separator only is malformed SRS address
+	if _, err := s.Forward("SRS0=@other.com"); err != srs.ErrNoUserSRS0 {
+		t.Errorf("Forward SRS0=@other.com: expected %v, got %v", srs.ErrNoUserSRS0, err)
+	}
+	if _, err := s.Forward("SRS1=@other.com"); err != srs.ErrNoUserSRS1 {
+		t.Errorf("Forward SRS1=@other.com: expected %v, got %v", srs.ErrNoUserSRS1, err)
+	}
+}
+
+func TestSchemeTag(t *testing.T) {
+	untagged := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	tagged := srs.SRS{
+		Secret:    []byte(secret),
+		Domain:    localdomain,
+		SchemeTag: '1',
+	}
+
+	for _, email := range []string{
+		"milos@mailspot.com",
+		"SRS0=8Zzm=IS=netmark.rs=milos@domain.com",
+	} {
+		fwdUntagged, err := untagged.Forward(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fwdTagged, err := tagged.Forward(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if hash := strings.SplitN(fwdTagged, "=", 3)[1]; len(hash) != 5 || hash[0] != '1' {
+			t.Errorf("Forward %s: expected tagged hash, got %s", email, fwdTagged)
+		}
+		if fwdTagged[6:] == fwdUntagged[5:] {
+			t.Errorf("Forward %s: tag is not included in hash input, got %s", email, fwdTagged)
+		}
+
+		if rvs, err := tagged.Reverse(fwdTagged); err != nil || rvs != email {
+			t.Errorf("Reverse %s: expected %s, got %s %v", fwdTagged, email, rvs, err)
+		}
+		// tagged engine rejects untagged addresses
+		if rvs, err := tagged.Reverse(fwdUntagged); err != srs.ErrHashInvalid {
+			t.Errorf("Reverse %s: expected %v, got %s %v", fwdUntagged, srs.ErrHashInvalid, rvs, err)
+		}
+
+		// untagged engine doesn't know about the tag
+		if _, err := untagged.Reverse(fwdTagged); err == nil {
+			t.Errorf("Reverse %s: expected error on untagged engine", fwdTagged)
+		}
+	}
+
+	bad := srs.SRS{Secret: []byte(secret), Domain: localdomain, SchemeTag: '='}
+	if err := bad.Validate(); err != srs.ErrSchemeTagConfig {
+		t.Errorf("Validate: expected %v, got %v", srs.ErrSchemeTagConfig, err)
+	}
+}
+
+func TestSchemeTagShiftedHost(t *testing.T) {
+	s := srs.SRS{
+		Secret:    []byte(secret),
+		Domain:    localdomain,
+		SchemeTag: 'm',
+	}
+	fwd, err := s.Forward("SRS0=8Zzm=IS=netmark.rs=milos@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// tag moved from hash field to the beginning of host
+	forged := strings.Replace(fwd, "SRS1=m", "SRS1=", 1)
+	forged = strings.Replace(forged, "=example.com==", "=mexample.com==", 1)
+	if rvs, err := s.Reverse(forged); err != srs.ErrHashInvalid {
+		t.Errorf("Reverse %s: expected %v, got %s %v", forged, srs.ErrHashInvalid, rvs, err)
+	}
+}
+
+func TestReverseAfterSeparatorChange(t *testing.T) {
+	s := srs.SRS{
+		Secret:         []byte(secret),
+		Domain:         localdomain,
+		FirstSeparator: "+",
+	}
+
+	srs0, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srs1, err := s.Forward("SRS0-8Zzm=IS=netmark.rs=milos@domain.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(srs0, "SRS0+") || !strings.HasPrefix(srs1, "SRS1+") {
+		t.Fatalf("Forward: expected + separator, got %s and %s", srs0, srs1)
+	}
+
+	s.FirstSeparator = "="
+	for _, tc := range []struct {
+		email    string
+		expected string
+	}{
+		{srs0, "milos@mailspot.com"},
+		{srs1, "SRS0-8Zzm=IS=netmark.rs=milos@domain.com"},
+	} {
+		if rvs, err := s.Reverse(tc.email); err != nil || rvs != tc.expected {
+			t.Errorf("Reverse %s: expected %s, got %s %v", tc.email, tc.expected, rvs, err)
+		}
+	}
+
+	// SRS1 minted with + is rewritten with new separator and keeps SRS0 separator
+	other := srs.SRS{
+		Secret: []byte(secret),
+		Domain: "other.com",
+	}
+	fwd, err := other.Forward(strings.Replace(srs1, localdomain, "forwarder.com", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(fwd, "SRS1=") || !strings.Contains(fwd, "=domain.com=-8Zzm=") {
+		t.Errorf("Forward %s: unexpected SRS1 address %s", srs1, fwd)
+	}
+	if rvs, err := other.Reverse(fwd); err != nil || rvs != "SRS0-8Zzm=IS=netmark.rs=milos@domain.com" {
+		t.Errorf("Reverse %s: expected SRS0-8Zzm=IS=netmark.rs=milos@domain.com, got %s %v", fwd, rvs, err)
+	}
+}
+
+func TestAcceptedPrefixes(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	expected := []string{"SRS0=", "SRS0+", "SRS0-", "SRS1=", "SRS1+", "SRS1-"}
+	if prefixes := s.AcceptedPrefixes(); !reflect.DeepEqual(prefixes, expected) {
+		t.Errorf("AcceptedPrefixes: expected %v, got %v", expected, prefixes)
+	}
+
+	s = srs.SRS{
+		Secret:   []byte(secret),
+		Domain:   localdomain,
+		Prefixes: srs.Prefixes{SRS0: "SRS2", SRS1: "LEGACY1"},
+	}
+	expected = []string{"SRS2=", "SRS2+", "SRS2-", "LEGACY1=", "LEGACY1+", "LEGACY1-"}
+	prefixes := s.AcceptedPrefixes()
+	if !reflect.DeepEqual(prefixes, expected) {
+		t.Errorf("AcceptedPrefixes: expected %v, got %v", expected, prefixes)
+	}
+
+	// every accepted prefix is recognized by Reverse
+	for _, prefix := range prefixes {
+		if _, err := s.Reverse(prefix + "XXXX=IS=domain.com=milos@" + localdomain); err == srs.ErrNotSRS {
+			t.Errorf("Reverse: prefix %s is not recognized", prefix)
+		}
+	}
+}
+
+func TestSecretForDomain(t *testing.T) {
+	secrets := map[string][]byte{
+		"mailspot.com": []byte("mailspot secret"),
+		"domain.com":   []byte("domain secret"),
+	}
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+		SecretForDomain: func(origDomain string) []byte {
+			return secrets[origDomain]
+		},
+	}
+	master := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+
+	for _, tc := range []struct {
+		email    string
+		expected string
+		secret   []byte
+	}{
+		{"milos@MailSpot.com", "milos@MailSpot.com", secrets["mailspot.com"]},
+		{"milos@domain.com", "milos@domain.com", secrets["domain.com"]},
+		{"milos@other.com", "milos@other.com", []byte(secret)}, // fallback to Secret
+		{"SRS0=8Zzm=IS=netmark.rs=milos@domain.com", "SRS0=8Zzm=IS=netmark.rs=milos@domain.com", secrets["domain.com"]},
+	} {
+		fwd, err := s.Forward(tc.email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rvs, err := s.Reverse(fwd); err != nil || rvs != tc.expected {
+			t.Errorf("Reverse %s: expected %s, got %s %v", fwd, tc.expected, rvs, err)
+		}
+
+		// address verifies only with derived secret
+		single := srs.SRS{Secret: tc.secret, Domain: localdomain}
+		if _, err := single.Reverse(fwd); err != nil {
+			t.Errorf("Reverse %s: expected valid hash for domain secret, got %v", fwd, err)
+		}
+		if string(tc.secret) != secret {
+			if _, err := master.Reverse(fwd); err != srs.ErrHashInvalid {
+				t.Errorf("Reverse %s: expected %v with master secret, got %v", fwd, srs.ErrHashInvalid, err)
+			}
+		}
+	}
+
+	// secret of one domain can't be used for address of another domain
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := strings.Replace(fwd, "=mailspot.com=", "=domain.com=", 1)
+	if _, err := s.Reverse(forged); err != srs.ErrHashInvalid {
+		t.Errorf("Reverse %s: expected %v, got %v", forged, srs.ErrHashInvalid, err)
+	}
+}
+
+func TestShortForeignSRS0(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+
+	for _, email := range []string{
+		"SRS0=IS=netmark.rs=milos@domain.com", // no hash
+		"SRS0=netmark.rs=milos@domain.com",
+		"SRS0+opaque@domain.com",
+		"SRS0=abcd@other.com", // junk is never signed as SRS1
+	} {
+		if _, err := s.Forward(email); err != srs.ErrNoUserSRS0 {
+			t.Errorf("Forward %s: expected %v, got %v", email, srs.ErrNoUserSRS0, err)
+		}
+	}
+
+	s.Lenient = true
+	for _, tc := range []struct {
+		email string
+		srs1  string
+	}{
+		{"SRS0=IS=netmark.rs=milos@domain.com", "=domain.com==IS=netmark.rs=milos@" + localdomain},
+		{"SRS0=netmark.rs=milos@domain.com", "=domain.com==netmark.rs=milos@" + localdomain},
+		{"SRS0+opaque@domain.com", "=domain.com=+opaque@" + localdomain},
+		{"SRS0=abcd@other.com", "=other.com==abcd@" + localdomain}, // opaque like postsrsd
+		{"SRS0=8Zzm=IS=netmark.rs=milos@domain.com", "=domain.com==8Zzm=IS=netmark.rs=milos@" + localdomain},
+	} {
+		fwd, err := s.Forward(tc.email)
+		if err != nil {
+			t.Errorf("Forward %s: %v", tc.email, err)
+			continue
+		}
+		if !strings.HasPrefix(fwd, "SRS1=") || len(strings.SplitN(fwd, "=", 3)[1]) != 4 || !strings.HasSuffix(fwd, tc.srs1) {
+			t.Errorf("Forward %s: expected SRS1=hash%s, got %s", tc.email, tc.srs1, fwd)
+		}
+		if rvs, err := s.Reverse(fwd); err != nil || rvs != tc.email {
+			t.Errorf("Reverse %s: expected %s, got %s %v", fwd, tc.email, rvs, err)
+		}
+	}
+
+	// prefix with separator only is still rejected
+	if _, err := s.Forward("SRS0=@domain.com"); err != srs.ErrNoUserSRS0 {
+		t.Errorf("Forward SRS0=@domain.com: expected %v, got %v", srs.ErrNoUserSRS0, err)
+	}
+}
+
+func TestReversePreservesCase(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+
+	for _, email := range []string{
+		"u@MixedCase.COM",
+		"Milos.Mileusnic@NASLOVI.NET",
+		"SRS0=8Zzm=IS=NetMark.RS=Milos@Domain.COM",
+	} {
+		fwd, err := s.Forward(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rvs, err := s.Reverse(fwd); err != nil || rvs != email {
+			t.Errorf("Reverse %s: expected %s, got %s %v", fwd, email, rvs, err)
+		}
+
+		// hash input is lower-cased, so case change of original address is valid
+		if !strings.HasPrefix(email, "SRS0") {
+			f := strings.SplitN(fwd, "=", 4)
+			lower := f[0] + "=" + f[1] + "=" + f[2] + "=" + strings.ToLower(f[3])
+			if rvs, err := s.Reverse(lower); err != nil || rvs != strings.ToLower(email) {
+				t.Errorf("Reverse %s: expected %s, got %s %v", lower, strings.ToLower(email), rvs, err)
+			}
+		}
+	}
+}
+
+func TestTimeSlot(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+
+	for _, tc := range []struct {
+		email string
+		slot  int
+		err   error
+	}{
+		{"SRS0=8Zzm=2W=netmark.rs=milos@" + localdomain, 854, nil},
+		{"SRS0=8Zzm=2V=netmark.rs=milos@" + localdomain, 853, nil},
+		{"SRS0+8Zzm=2v=netmark.rs=milos@" + localdomain, 853, nil},
+		{"SRS0=8Zzm=IS=netmark.rs=milos@domain.com", 274, nil},
+		{"SRS0=8Zzm=B=netmark.rs=milos@" + localdomain, 1, nil},
+		{"SRS0=8Zzm=I1=netmark.rs=milos@" + localdomain, 0, srs.ErrTimestampInvalidBase32},
+		{"SRS0=8Zzm=IS=netmark.rs@" + localdomain, 0, srs.ErrNoUserSRS0},
+		{"SRS1=50B9=domain.com==8Zzm=IS=netmark.rs=milos@" + localdomain, 0, srs.ErrNotSRS},
+		{"milos@mailspot.com", 0, srs.ErrNotSRS},
+	} {
+		slot, err := s.TimeSlot(tc.email)
+		if slot != tc.slot || err != tc.err {
+			t.Errorf("TimeSlot %s: expected %d %v, got %d %v", tc.email, tc.slot, tc.err, slot, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		ts   string
+		slot int
+	}{
+		{"", 0},
+		{"A", 0},
+		{"7", 31},
+		{"BA", 32},
+		{"77", 1023},
+	} {
+		if slot, err := srs.Base32Decode(tc.ts); slot != tc.slot || err != nil {
+			t.Errorf("Base32Decode %s: expected %d, got %d %v", tc.ts, tc.slot, slot, err)
+		}
+	}
+
+	// over-long timestamps would overflow int
+	for _, ts := range []string{"AAA", "7777777777777", strings.Repeat("A", 20) + "IS"} {
+		if _, err := srs.Base32Decode(ts); err != srs.ErrTimestampInvalidBase32 {
+			t.Errorf("Base32Decode %s: expected %v, got %v", ts, srs.ErrTimestampInvalidBase32, err)
+		}
+		email := "SRS0=8Zzm=" + ts + "=netmark.rs=milos@" + localdomain
+		if _, err := s.Reverse(email); err != srs.ErrTimestampInvalidBase32 {
+			t.Errorf("Reverse %s: expected %v, got %v", email, srs.ErrTimestampInvalidBase32, err)
+		}
+	}
+}
+
+func TestForwardOwnAddresses(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+
+	srs0, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srs1, err := s.Forward("SRS0=8Zzm=IS=netmark.rs=milos@domain.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, email := range []string{
+		srs0,
+		srs1,
+		strings.ToUpper(srs0[:len(srs0)-len(localdomain)]) + strings.ToUpper(localdomain),
+		strings.Replace(srs1, localdomain, "LocalHost.LocalDomain", 1),
+		"milos@LOCALHOST.localdomain",
+	} {
+		fwd, err := s.Forward(email)
+		if err != nil || fwd != email {
+			t.Errorf("Forward %s: expected address unchanged, got %s %v", email, fwd, err)
+		}
+	}
+}
+
+func TestPackageFuncs(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+
+	emails := generateEmails(srsCli)
+	for _, email := range emails {
+		expected, expectedErr := s.Forward(email)
+		fwd, err := srs.Forward([]byte(secret), localdomain, email)
+		if fwd != expected || err != expectedErr {
+			t.Errorf("Forward %s: expected %s %v, got %s %v", email, expected, expectedErr, fwd, err)
+		}
+
+		expected, expectedErr = s.Reverse(email)
+		rvs, err := srs.Reverse([]byte(secret), localdomain, email)
+		if rvs != expected || err != expectedErr {
+			t.Errorf("Reverse %s: expected %s %v, got %s %v", email, expected, expectedErr, rvs, err)
+		}
+	}
+}
+
+func TestZeroNow(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.NowFunc = func() time.Time { return time.Time{} }
+	if _, err := s.Forward("milos@mailspot.com"); err != srs.ErrInvalidNow {
+		t.Errorf("Forward: expected %v, got %v", srs.ErrInvalidNow, err)
+	}
+	if _, err := s.Reverse(fwd); err != srs.ErrInvalidNow {
+		t.Errorf("Reverse: expected %v, got %v", srs.ErrInvalidNow, err)
+	}
+	if _, err := s.HashInput("milos@mailspot.com"); err != srs.ErrInvalidNow {
+		t.Errorf("HashInput: expected %v, got %v", srs.ErrInvalidNow, err)
+	}
+}
+
+func TestReverseAll(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	// broken upstream doesn't recognize SRS0 addresses and wraps them again,
+	// simulated by engine with different prefix since prefix is not hashed
+	broken := srs.SRS{
+		Secret:   []byte(secret),
+		Domain:   localdomain,
+		Prefixes: srs.Prefixes{SRS0: "SRSX", SRS1: "SRSY"},
+	}
+	wrap := func(email string) string {
+		fwd, err := broken.Forward(strings.Replace(email, localdomain, "upstream.com", 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "SRS0" + strings.TrimPrefix(fwd, "SRSX")
+	}
+
+	inner, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	double := wrap(inner)
+	triple := wrap(double)
+
+	for _, tc := range []struct {
+		email   string
+		reverse string
+		all     string
+	}{
+		{inner, "milos@mailspot.com", "milos@mailspot.com"},
+		{double, strings.Replace(inner, localdomain, "upstream.com", 1), "milos@mailspot.com"},
+		{triple, strings.Replace(double, localdomain, "upstream.com", 1), "milos@mailspot.com"},
+	} {
+		if rvs, err := s.Reverse(tc.email); err != nil || rvs != tc.reverse {
+			t.Errorf("Reverse %s: expected %s, got %s %v", tc.email, tc.reverse, rvs, err)
+		}
+		if rvs, err := s.ReverseAll(tc.email); err != nil || rvs != tc.all {
+			t.Errorf("ReverseAll %s: expected %s, got %s %v", tc.email, tc.all, rvs, err)
+		}
+	}
+
+	// inner layer signed by another forwarder is not unwrapped
+	foreign := "SRS0=8Zzm=IS=netmark.rs=milos@upstream.com"
+	double = wrap(foreign)
+	if rvs, err := s.ReverseAll(double); err != nil || rvs != foreign {
+		t.Errorf("ReverseAll %s: expected %s, got %s %v", double, foreign, rvs, err)
+	}
+
+	// outer layer is always validated
+	if _, err := s.ReverseAll("SRS0=XXXX" + double[9:]); err != srs.ErrHashInvalid {
+		t.Errorf("ReverseAll: expected %v, got %v", srs.ErrHashInvalid, err)
+	}
+}
+
+func TestReverseChain(t *testing.T) {
+	s := srs.SRS{
+		Secret:  []byte("tops3cr3t"),
+		Domain:  "example.com",
+		NowFunc: func() time.Time { return time.Date(2020, 1, 1, 0, 1, 0, 0, time.UTC) },
+	}
+	srs0, err := s.Forward("test@otherdomain.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		email string
+		chain []string
+		err   error
+	}{
+		{
+			"SRS1=Qlji=thirddomain.com==vmyz=2W=otherdomain.com=test@example.com",
+			[]string{
+				"SRS1=Qlji=thirddomain.com==vmyz=2W=otherdomain.com=test@example.com",
+				"SRS0=vmyz=2W=otherdomain.com=test@thirddomain.com",
+				"test@otherdomain.com",
+			},
+			nil,
+		},
+		{
+			"SRS1=JIBX=thirddomain.com==opaque+string@example.com",
+			[]string{
+				"SRS1=JIBX=thirddomain.com==opaque+string@example.com",
+				"SRS0=opaque+string@thirddomain.com",
+			},
+			nil,
+		},
+		{srs0, []string{srs0, "test@otherdomain.com"}, nil},
+		{"SRS1=XXXX=thirddomain.com==vmyz=2W=otherdomain.com=test@example.com", nil, srs.ErrHashInvalid},
+		{"test@example.com", nil, srs.ErrNotSRS},
+	} {
+		chain, err := s.ReverseChain(tc.email)
+		if !reflect.DeepEqual(chain, tc.chain) || err != tc.err {
+			t.Errorf("ReverseChain %s: expected %v %v, got %v %v", tc.email, tc.chain, tc.err, chain, err)
+		}
+	}
+}
+
+func TestParseSRS1HashSeparator(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+
+	// foreign SRS1 with = padding in hash, scanner would match == within hash
+	foreign := "SRS1=ab==domain.com==8Zzm=IS=netmark.rs=milos@other.com"
+	fwd, err := s.Forward(foreign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(fwd, "SRS1=") || !strings.HasSuffix(fwd, "=domain.com==8Zzm=IS=netmark.rs=milos@"+localdomain) {
+		t.Errorf("Forward %s: unexpected SRS1 address %s", foreign, fwd)
+	}
+	if rvs, err := s.Reverse(fwd); err != nil || rvs != "SRS0=8Zzm=IS=netmark.rs=milos@domain.com" {
+		t.Errorf("Reverse %s: expected SRS0=8Zzm=IS=netmark.rs=milos@domain.com, got %s %v", fwd, rvs, err)
+	}
+
+	// foreign hash shorter than HashLength
+	long := srs.SRS{
+		Secret:     []byte(secret),
+		Domain:     localdomain,
+		HashLength: 16,
+	}
+	foreign = "SRS1=abcd=gmail.com==8Zzm=IS=netmark.rs=milos@other.com"
+	if fwd, err = long.Forward(foreign); err != nil {
+		t.Fatalf("Forward %s with HashLength 16: %v", foreign, err)
+	}
+	if rvs, err := long.Reverse(fwd); err != nil || rvs != "SRS0=8Zzm=IS=netmark.rs=milos@gmail.com" {
+		t.Errorf("Reverse %s: expected SRS0=8Zzm=IS=netmark.rs=milos@gmail.com, got %s %v", fwd, rvs, err)
+	}
+
+	// compound separator only within hash field
+	for _, email := range []string{
+		"SRS1===@domain.com",
+		"SRS1=dd==8Znm=IC=netmark.rs=milos@domain.com",
+		"SRS1=ddd==8Znm=IC=netmark.rs=milos@domain.com",
+	} {
+		if _, err := s.Forward(email); err != srs.ErrHashTooShort {
+			t.Errorf("Forward %s: expected %v, got %v", email, srs.ErrHashTooShort, err)
+		}
+	}
+}
+
+func TestCaseSensitiveHash(t *testing.T) {
+	now := func() time.Time { return time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC) }
+	s := srs.SRS{
+		Secret:  []byte(secret),
+		Domain:  localdomain,
+		NowFunc: now,
+	}
+	fwd, err := s.Forward("Milos@MailSpot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := strings.Split(fwd, "=")[2]
+
+	// SRS0 minted by foreign implementation which doesn't lower-case hash input
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(ts + "MailSpot.com" + "Milos"))
+	hash := base64.StdEncoding.EncodeToString(mac.Sum(nil))[:4]
+	foreign := "SRS0=" + hash + "=" + ts + "=MailSpot.com=Milos@" + localdomain
+
+	if _, err := s.Reverse(foreign); err != srs.ErrHashInvalid {
+		t.Errorf("Reverse %s: expected %v, got %v", foreign, srs.ErrHashInvalid, err)
+	}
+
+	cs := srs.SRS{
+		Secret:            []byte(secret),
+		Domain:            localdomain,
+		NowFunc:           now,
+		CaseSensitiveHash: true,
+	}
+	if rvs, err := cs.Reverse(foreign); err != nil || rvs != "Milos@MailSpot.com" {
+		t.Errorf("Reverse %s: expected Milos@MailSpot.com, got %s %v", foreign, rvs, err)
+	}
+
+	// forward and reverse are symmetric
+	fwd, err = cs.Forward("Milos@MailSpot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fwd != foreign {
+		t.Errorf("Forward: expected %s, got %s", foreign, fwd)
+	}
+	fwd, err = cs.Forward("SRS0=8Zzm=IS=NetMark.rs=Milos@Domain.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rvs, err := cs.Reverse(fwd); err != nil || rvs != "SRS0=8Zzm=IS=NetMark.rs=Milos@Domain.com" {
+		t.Errorf("Reverse %s: expected SRS0=8Zzm=IS=NetMark.rs=Milos@Domain.com, got %s %v", fwd, rvs, err)
+	}
+	if _, err := s.Reverse(fwd); err != srs.ErrHashInvalid {
+		t.Errorf("Reverse %s: expected %v in default mode, got %v", fwd, srs.ErrHashInvalid, err)
+	}
+}
+
+func TestDisplayOriginal(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	srs0, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srs1, err := s.Forward("SRS0=8Zzm=IS=netmark.rs=milos@domain.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		email    string
+		expected string
+		err      error
+	}{
+		{srs0, "milos@mailspot.com", nil},
+		{"SRS0=XXXX" + srs0[9:], "milos@mailspot.com", nil},                       // tampered hash
+		{"SRS0=8Zzm=IS=netmark.rs=milos@" + localdomain, "milos@netmark.rs", nil}, // expired
+		{srs1, "milos@netmark.rs", nil},
+		{"SRS1=XXXX=domain.com==8Zzm=IS=netmark.rs=milos@" + localdomain, "milos@netmark.rs", nil},
+		{"SRS1=XXXX=thirddomain.com==opaque+string@" + localdomain, "SRS0=opaque+string@thirddomain.com", nil},
+		{"SRS0=XXXX=IS=upstream.com=SRS0=8Zzm=IS=netmark.rs=milos@" + localdomain, "milos@netmark.rs", nil},
+		{"SRS0=XXXX=IS=upstream.com=SRS0=opaque@" + localdomain, "SRS0=opaque@upstream.com", nil},
+		{"milos@mailspot.com", "", srs.ErrNotSRS},
+		{"SRS0=XXXX=IS@" + localdomain, "", srs.ErrNoUserSRS0},
+	} {
+		orig, err := s.DisplayOriginal(tc.email)
+		if orig != tc.expected || err != tc.err {
+			t.Errorf("DisplayOriginal %s: expected %s %v, got %s %v", tc.email, tc.expected, tc.err, orig, err)
+		}
+	}
+}
+
+func TestOutDomainFunc(t *testing.T) {
+	db := make(map[string]string)
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+		OutDomainFunc: func(origDomain string) string {
+			return "srs." + localdomain
+		},
+		Store: func(srsLocal, original string) {
+			db[srsLocal] = original
+		},
+	}
+
+	for _, tc := range []struct {
+		email    string
+		expected string
+	}{
+		{"SRS0=8Zzm=IS=netmark.rs=milos@domain.com", "SRS1=50B9=domain.com==8Zzm=IS=netmark.rs=milos@srs." + localdomain},
+		{"milos@" + localdomain, "milos@" + localdomain},
+	} {
+		fwd, err := s.Forward(tc.email)
+		if err != nil || fwd != tc.expected {
+			t.Errorf("Forward %s: expected %s, got %s %v", tc.email, tc.expected, fwd, err)
+		}
+	}
+	if _, ok := db["SRS1=50B9=domain.com==8Zzm=IS=netmark.rs=milos"]; !ok {
+		t.Errorf("Store: expected local part without host, got %v", db)
+	}
+
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(fwd, "@srs."+localdomain) {
+		t.Errorf("Forward: expected host srs.%s, got %s", localdomain, fwd)
+	}
+	rvs, err := s.Reverse(fwd)
+	if err != nil || rvs != "milos@mailspot.com" {
+		t.Errorf("Reverse %s: expected milos@mailspot.com, got %s %v", fwd, rvs, err)
+	}
+}
+
+func TestDelimitHashInput(t *testing.T) {
+	now := time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC)
+	for _, delimit := range []bool{false, true} {
+		s := srs.SRS{
+			Secret:           []byte(secret),
+			Domain:           localdomain,
+			DelimitHashInput: delimit,
+			NowFunc:          func() time.Time { return now },
+		}
+		fwd, err := s.Forward("milos@netmark.rs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rvs, err := s.Reverse(fwd)
+		if err != nil || rvs != "milos@netmark.rs" {
+			t.Errorf("Reverse %s: expected milos@netmark.rs, got %s %v", fwd, rvs, err)
+		}
+
+		// shift host and user boundary keeping the same hash
+		forged := strings.Replace(fwd, "=netmark.rs=milos@", "=netmark.r=smilos@", 1)
+		rvs, err = s.Reverse(forged)
+		if delimit && err != srs.ErrHashInvalid {
+			t.Errorf("Reverse %s: expected %v, got %s %v", forged, srs.ErrHashInvalid, rvs, err)
+		}
+		if !delimit && (err != nil || rvs != "smilos@netmark.r") {
+			t.Errorf("Reverse %s: expected forgery smilos@netmark.r to pass without delimiter, got %s %v", forged, rvs, err)
+		}
+	}
+}
+
+func TestBindDomainLength(t *testing.T) {
+	now := time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC)
+	for _, bind := range []bool{false, true} {
+		s := srs.SRS{
+			Secret:           []byte(secret),
+			Domain:           localdomain,
+			BindDomainLength: bind,
+			NowFunc:          func() time.Time { return now },
+		}
+		for _, email := range []string{"milos@netmark.rs", "SRS0=8Zzm=IS=netmark.rs=milos@domain.com"} {
+			fwd, err := s.Forward(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rvs, err := s.Reverse(fwd); rvs != email || err != nil {
+				t.Errorf("Reverse %s: expected %s, got %s %v", fwd, email, rvs, err)
+			}
+		}
+
+		// shift host and user boundary keeping the same hash
+		fwd, err := s.Forward("milos@netmark.rs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		forged := strings.Replace(fwd, "=netmark.rs=milos@", "=netmark.r=smilos@", 1)
+		rvs, err := s.Reverse(forged)
+		if bind && err != srs.ErrHashInvalid {
+			t.Errorf("Reverse %s: expected %v, got %s %v", forged, srs.ErrHashInvalid, rvs, err)
+		}
+		if !bind && (err != nil || rvs != "smilos@netmark.r") {
+			t.Errorf("Reverse %s: expected forgery smilos@netmark.r to pass without domain length, got %s %v", forged, rvs, err)
+		}
+
+		// addresses are not compatible with default mode
+		if _, err := (&srs.SRS{Secret: []byte(secret), Domain: localdomain, NowFunc: s.NowFunc}).Reverse(fwd); bind && err != srs.ErrHashInvalid {
+			t.Errorf("Reverse %s in default mode: expected %v, got %v", fwd, srs.ErrHashInvalid, err)
+		}
+	}
+}
+
+// postsrsdVectors are forward and reverse vectors in testdata, with the same
+// secret, domain and time as postsrsd test suite. Add new vectors there when
+// interop bugs are found, vectors with skip set document known differences.
+type postsrsdVectors struct {
+	Secret  string    `json:"secret"`
+	Domain  string    `json:"domain"`
+	Time    time.Time `json:"time"`
+	Vectors []struct {
+		Op      string `json:"op"`
+		Input   string `json:"input"`
+		Output  string `json:"output"`
+		Error   string `json:"error"`
+		Lenient bool   `json:"lenient"`
+		Skip    string `json:"skip"`
+	} `json:"vectors"`
+}
+
+func TestPostSRSdVectors(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/postsrsd_vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data postsrsdVectors
+	if err := json.Unmarshal(b, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	// postsrsd preset produces the same results as default options
+	for _, compat := range []srs.Compatibility{srs.CompatNone, srs.CompatPostSRSd} {
+		for _, v := range data.Vectors {
+			v := v
+			t.Run(fmt.Sprint(compat)+" "+v.Op+" "+v.Input, func(t *testing.T) {
+				if v.Skip != "" {
+					t.Skip(v.Skip)
+				}
+				s := srs.SRS{
+					Secret:        []byte(data.Secret),
+					Domain:        data.Domain,
+					Lenient:       v.Lenient,
+					Compatibility: compat,
+					NowFunc:       func() time.Time { return data.Time },
+				}
+
+				var out string
+				var err error
+				switch v.Op {
+				case "forward":
+					out, err = s.Forward(v.Input)
+				case "reverse":
+					out, err = s.Reverse(v.Input)
+				default:
+					t.Fatalf("unknown op %q", v.Op)
+				}
+
+				var errStr string
+				if err != nil {
+					errStr = err.Error()
+				}
+				if out != v.Output || errStr != v.Error {
+					t.Errorf("expected %q %q, got %q %q", v.Output, v.Error, out, errStr)
+				}
+			})
+		}
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	if err := s.Warmup(); err != nil {
+		t.Fatal(err)
+	}
+	if s.FirstSeparator != "=" || s.HashLength != 4 || s.Prefixes.SRS0 != "SRS0" || s.Prefixes.SRS1 != "SRS1" {
+		t.Errorf("Warmup: defaults not set, got %q %d %+v", s.FirstSeparator, s.HashLength, s.Prefixes)
+	}
+
+	// engine is safe for concurrent use after warmup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			if fwd, err := s.Forward("milos@mailspot.com"); err == nil {
+				s.Reverse(fwd)
+			}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+
+	// and without warmup, the first calls initialize it once
+	for _, cacheSize := range []int{0, 10} {
+		s := srs.SRS{Secret: []byte(secret), Domain: localdomain, CacheSize: cacheSize}
+		for i := 0; i < 4; i++ {
+			go func() {
+				defer func() { done <- struct{}{} }()
+				if fwd, err := s.Forward("milos@mailspot.com"); err == nil {
+					s.Reverse(fwd)
+				}
+			}()
+		}
+		for i := 0; i < 4; i++ {
+			<-done
+		}
+		if stats := s.Stats(); stats.Forwards != 4 || stats.Reverses != 4 {
+			t.Errorf("concurrent first calls with CacheSize %d: expected 4 forwards and reverses, got %+v", cacheSize, stats)
+		}
+	}
+
+	s = srs.SRS{Secret: []byte(secret), Domain: localdomain, HashLength: 2}
+	if err := s.Warmup(); err != srs.ErrHashTooShortConfig {
+		t.Errorf("Warmup: expected %v, got %v", srs.ErrHashTooShortConfig, err)
+	}
+}
+
+func TestForwardVariants(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 1, 0, 0, time.UTC)
+	s := srs.SRS{
+		Secret:  []byte(secret),
+		Domain:  localdomain,
+		NowFunc: func() time.Time { return now },
+	}
+
+	for _, tc := range []struct {
+		email string
+		srs1  bool
+		err   error
+	}{
+		{"milos@mailspot.com", false, nil},
+		{"SRS0=8Zzm=IS=netmark.rs=milos@domain.com", true, nil},
+		{"SRS1=50B9=domain.net==8Zzm=IS=netmark.rs=milos@domain.com", true, nil},
+		{"SRS0=abcd@domain.com", false, srs.ErrNoUserSRS0},
+	} {
+		srs0, srs1, err := s.ForwardVariants(tc.email)
+		if err != tc.err {
+			t.Errorf("ForwardVariants %s: expected %v, got %v", tc.email, tc.err, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		local := tc.email[:strings.LastIndex(tc.email, "@")]
+		host := tc.email[strings.LastIndex(tc.email, "@")+1:]
+		if !strings.HasPrefix(srs0, "SRS0=") || !strings.HasSuffix(srs0, "=2W="+host+"="+local+"@"+localdomain) {
+			t.Errorf("ForwardVariants %s: unexpected SRS0 variant %s", tc.email, srs0)
+		}
+		if rvs, err := s.Reverse(srs0); err != nil || rvs != tc.email {
+			t.Errorf("Reverse %s: expected %s, got %s %v", srs0, tc.email, rvs, err)
+		}
+
+		fwd, _ := s.Forward(tc.email)
+		if tc.srs1 && srs1 != fwd || !tc.srs1 && (srs1 != "" || srs0 != fwd) {
+			t.Errorf("ForwardVariants %s: expected to match Forward %s, got %s %s", tc.email, fwd, srs0, srs1)
+		}
+	}
+
+	srs0, srs1, err := s.ForwardVariants("milos@" + localdomain)
+	if srs0 != "" || srs1 != "" || err != nil {
+		t.Errorf("ForwardVariants local address: expected empty variants, got %s %s %v", srs0, srs1, err)
+	}
+
+	// variants agree with Forward
+	for _, e := range []srs.SRS{
+		s,
+		{Secret: []byte(secret), Domain: localdomain, NowFunc: s.NowFunc, KeepSRS1: true},
+		{Secret: []byte(secret), Domain: localdomain, NowFunc: s.NowFunc, RejectSRS1: true},
+		{Secret: []byte(secret), Domain: localdomain, NowFunc: s.NowFunc, RejectEmptyDomain: true},
+	} {
+		for _, email := range []string{
+			"milos@mailspot.com",
+			"milos@",
+			"\"milos m\"@mailspot.com",
+			"SRS0=8Zzm=IS=netmark.rs=milos@domain.com",
+			"SRS1=50B9=domain.net==8Zzm=IS=netmark.rs=milos@domain.com",
+			"milos@" + localdomain,
+		} {
+			srs0, srs1, err := e.ForwardVariants(email)
+			fwd, fwdErr := e.Forward(email)
+			expected := srs1
+			if expected == "" {
+				expected = srs0
+			}
+			if expected == "" && err == nil {
+				expected = email
+			}
+			if err != fwdErr || expected != fwd {
+				t.Errorf("ForwardVariants %s: got %q %q %v, Forward %q %v", email, srs0, srs1, err, fwd, fwdErr)
+			}
+		}
+	}
+}
+
+func TestMaxInputLength(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+
+	long := "SRS1=50B9=domain.com=" + strings.Repeat("=", 1024) + "8Zzm=IS=netmark.rs=milos@" + localdomain
+	if _, err := s.Forward(long); err != srs.ErrInputTooLong {
+		t.Errorf("Forward: expected %v, got %v", srs.ErrInputTooLong, err)
+	}
+	if _, err := s.Reverse(long); err != srs.ErrInputTooLong {
+		t.Errorf("Reverse: expected %v, got %v", srs.ErrInputTooLong, err)
+	}
+	if st := s.Stats(); st.ParseErrors != 2 {
+		t.Errorf("Stats: expected 2 parse errors, got %d", st.ParseErrors)
+	}
+
+	s = srs.SRS{
+		Secret:         []byte(secret),
+		Domain:         localdomain,
+		MaxInputLength: 40,
+	}
+	if _, err := s.Forward("milos@mailspot.com"); err != nil {
+		t.Errorf("Forward: %v", err)
+	}
+	if _, err := s.Reverse("SRS0=8Zzm=IS=netmark.rs=milos@" + localdomain); err != srs.ErrInputTooLong {
+		t.Errorf("Reverse: expected %v, got %v", srs.ErrInputTooLong, err)
+	}
+}
+
+func TestStrictReverseDomain(t *testing.T) {
+	s := srs.SRS{
+		Secret:              []byte(secret),
+		Domain:              localdomain,
+		AltDomains:          []string{"fwd.example.com", "Fwd.Example.NET"},
+		StrictReverseDomain: true,
+	}
+
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := strings.TrimSuffix(fwd, "@"+localdomain)
+
+	for _, tc := range []struct {
+		host string
+		err  error
+	}{
+		{localdomain, nil},
+		{"fwd.example.com", nil},
+		{"FWD.example.com", nil},
+		{"fwd.example.net", nil},
+		{"other.com", srs.ErrWrongDomain},
+	} {
+		rvs, err := s.Reverse(local + "@" + tc.host)
+		if err != tc.err || err == nil && rvs != "milos@mailspot.com" {
+			t.Errorf("Reverse %s@%s: expected %v, got %s %v", local, tc.host, tc.err, rvs, err)
+		}
+	}
+
+	// alternative domains are local, so their addresses are not rewritten
+	if fwd, err := s.Forward("milos@fwd.example.com"); err != nil || fwd != "milos@fwd.example.com" {
+		t.Errorf("Forward milos@fwd.example.com: expected unchanged, got %s %v", fwd, err)
+	}
+
+	// host is ignored by default
+	s.StrictReverseDomain = false
+	if rvs, err := s.Reverse(local + "@other.com"); err != nil || rvs != "milos@mailspot.com" {
+		t.Errorf("Reverse %s@other.com: expected milos@mailspot.com, got %s %v", local, rvs, err)
+	}
+}
+
+func TestFullChecksum(t *testing.T) {
+	s := srs.SRS{
+		Secret:       []byte(secret),
+		Domain:       localdomain,
+		FullChecksum: true,
+	}
+
+	for _, tc := range []struct {
+		email    string
+		original string
+	}{
+		{"milos@mailspot.com", "milos@mailspot.com"},
+		{"SRS0=8Zzm=IS=netmark.rs=milos@domain.com", "milos@netmark.rs"},
+	} {
+		email := tc.email
+		fwd, err := s.Forward(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rvs, err := s.Reverse(fwd); err != nil || rvs != email {
+			t.Errorf("Reverse %s: expected %s, got %s %v", fwd, email, rvs, err)
+		}
+		if orig, err := s.DisplayOriginal(fwd); err != nil || orig != tc.original {
+			t.Errorf("DisplayOriginal %s: expected %s, got %s %v", fwd, tc.original, orig, err)
+		}
+
+		// any changed character of local part is detected, host is not signed
+		local := fwd[:strings.LastIndex(fwd, "@")]
+		for i := 5; i < len(local); i++ {
+			c := byte('x')
+			if local[i] == 'x' || local[i] == 'X' {
+				c = 'y'
+			}
+			tampered := local[:i] + string(c) + local[i+1:] + fwd[len(local):]
+			if rvs, err := s.Reverse(tampered); err == nil {
+				t.Errorf("Reverse %s: expected error, got %s", tampered, rvs)
+			}
+		}
+
+		// default mode doesn't accept full checksum addresses
+		plain := srs.SRS{Secret: []byte(secret), Domain: localdomain}
+		if rvs, err := plain.Reverse(fwd); err == nil && rvs == email {
+			t.Errorf("Reverse %s without FullChecksum: expected failure, got %s", fwd, rvs)
+		}
+	}
+}
+
+func TestCompatibleWith(t *testing.T) {
+	s := &srs.SRS{Secret: []byte(secret), Domain: localdomain}
+
+	for _, tc := range []struct {
+		other      *srs.SRS
+		compatible bool
+		err        error
+	}{
+		{&srs.SRS{Secret: []byte(secret), Domain: "partner.com"}, true, nil},
+		{&srs.SRS{Secret: []byte(secret), Domain: "partner.com", FirstSeparator: "+"}, true, nil},
+		{&srs.SRS{Secret: []byte("other secret"), Domain: "partner.com"}, false, nil},
+		{&srs.SRS{Secret: []byte(secret), Domain: "partner.com", HashLength: 6}, false, nil},
+		{&srs.SRS{Secret: []byte(secret), Domain: "partner.com", CaseSensitiveHash: true}, false, nil},
+		{&srs.SRS{Secret: []byte(secret), Domain: "partner.com", HashLength: 2}, false, srs.ErrHashTooShortConfig},
+	} {
+		compatible, err := s.CompatibleWith(tc.other)
+		if compatible != tc.compatible || err != tc.err {
+			t.Errorf("CompatibleWith %+v: expected %v %v, got %v %v", tc.other, tc.compatible, tc.err, compatible, err)
+		}
+	}
+
+	// canaries are not stored or counted
+	stored := 0
+	store := func(string, string) { stored++ }
+	a := &srs.SRS{Secret: []byte(secret), Domain: localdomain, Store: store}
+	b := &srs.SRS{Secret: []byte(secret), Domain: "partner.com", Store: store}
+	if compatible, err := a.CompatibleWith(b); !compatible || err != nil {
+		t.Errorf("CompatibleWith: expected true, got %v %v", compatible, err)
+	}
+	if stored != 0 || a.Stats() != (srs.Stats{}) || b.Stats() != (srs.Stats{}) {
+		t.Errorf("CompatibleWith: expected no stored canaries and no stats, got %d %+v %+v", stored, a.Stats(), b.Stats())
+	}
+}
+
+func TestNegativeUnixTime(t *testing.T) {
+	for _, tc := range []struct {
+		now  time.Time
+		slot int
+	}{
+		{time.Date(1969, 12, 31, 12, 0, 0, 0, time.UTC), 1023},
+		{time.Date(1969, 12, 1, 0, 0, 0, 0, time.UTC), 993},
+		{time.Unix(-1024*24*60*60, 0), 0}, // start of previous cycle
+		{time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), 0},
+	} {
+		now := tc.now
+		s := srs.SRS{
+			Secret:  []byte(secret),
+			Domain:  localdomain,
+			NowFunc: func() time.Time { return now },
+		}
+		fwd, err := s.Forward("milos@mailspot.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slot, err := s.TimeSlot(fwd); slot != tc.slot || err != nil {
+			t.Errorf("TimeSlot %s at %s: expected %d, got %d %v", fwd, now, tc.slot, slot, err)
+		}
+		if rvs, err := s.Reverse(fwd); err != nil || rvs != "milos@mailspot.com" {
+			t.Errorf("Reverse %s: expected milos@mailspot.com, got %s %v", fwd, rvs, err)
+		}
+	}
+}
+
+func TestExpiredHashValidity(t *testing.T) {
+	now := time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC)
+	old := srs.SRS{
+		Secret:  []byte(secret),
+		Domain:  localdomain,
+		NowFunc: func() time.Time { return now.AddDate(0, 0, -30) },
+	}
+	s := srs.SRS{
+		Secret:  []byte(secret),
+		Domain:  localdomain,
+		NowFunc: func() time.Time { return now },
+	}
+
+	expired, err := old.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := "SRS0=XXXX" + expired[9:]
+
+	for _, tc := range []struct {
+		email string
+		err   error
+	}{
+		{expired, srs.ErrTimestampExpired}, // replayed genuine address
+		{forged, srs.ErrHashInvalid},       // garbage with expired timestamp
+	} {
+		if _, err := s.Reverse(tc.email); err != tc.err {
+			t.Errorf("Reverse %s: expected %v, got %v", tc.email, tc.err, err)
+		}
+	}
+}
+
+func TestStrictFields(t *testing.T) {
+	now := time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC)
+	s := srs.SRS{
+		Secret:       []byte(secret),
+		Domain:       localdomain,
+		StrictFields: true,
+		NowFunc:      func() time.Time { return now },
+	}
+
+	fwd, err := s.Forward("milos@netmark.rs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rvs, err := s.Reverse(fwd); err != nil || rvs != "milos@netmark.rs" {
+		t.Errorf("Reverse %s: expected milos@netmark.rs, got %s %v", fwd, rvs, err)
+	}
+
+	// shifted splits with the same hash input
+	for _, shifted := range []string{"=netmark.=rsmilos@", "=netmark=.rsmilos@"} {
+		forged := strings.Replace(fwd, "=netmark.rs=milos@", shifted, 1)
+		if rvs, err := s.Reverse(forged); err != srs.ErrImplausibleFields {
+			t.Errorf("Reverse %s: expected %v, got %s %v", forged, srs.ErrImplausibleFields, rvs, err)
+		}
+		lax := s
+		lax.StrictFields = false
+		if _, err := lax.Reverse(forged); err != nil {
+			t.Errorf("Reverse %s without StrictFields: %v", forged, err)
+		}
+	}
+
+	srs1, err := s.Forward("SRS0=8Zzm=IS=netmark.rs=milos@domain.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Reverse(srs1); err != nil {
+		t.Errorf("Reverse %s: %v", srs1, err)
+	}
+	forged := strings.Replace(srs1, "=domain.com==", "=domain.=com=", 1)
+	if _, err := s.Reverse(forged); err == nil {
+		t.Errorf("Reverse %s: expected error", forged)
+	}
+}
+
+func TestBindHost(t *testing.T) {
+	s := srs.SRS{
+		Secret:   []byte(secret),
+		Domain:   localdomain,
+		BindHost: true,
+	}
+
+	for _, email := range []string{"milos@mailspot.com", "SRS0=8Zzm=IS=netmark.rs=milos@domain.com"} {
+		fwd, err := s.Forward(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		local := strings.TrimSuffix(fwd, "@"+localdomain)
+
+		for _, tc := range []struct {
+			host string
+			err  error
+		}{
+			{localdomain, nil},
+			{strings.ToUpper(localdomain), nil},
+			{"evil.com", srs.ErrHashInvalid},
+		} {
+			rvs, err := s.Reverse(local + "@" + tc.host)
+			if err != tc.err || err == nil && rvs != email {
+				t.Errorf("Reverse %s@%s: expected %v, got %s %v", local, tc.host, tc.err, rvs, err)
+			}
+		}
+
+		// host is not bound by default
+		plain := srs.SRS{Secret: []byte(secret), Domain: localdomain}
+		if rvs, err := plain.Reverse(fwd); err == nil {
+			t.Errorf("Reverse %s without BindHost: expected error, got %s", fwd, rvs)
+		}
+	}
+
+	// host from OutDomainFunc is bound
+	s.OutDomainFunc = func(origDomain string) string { return "srs." + localdomain }
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rvs, err := s.Reverse(fwd); err != nil || rvs != "milos@mailspot.com" {
+		t.Errorf("Reverse %s: expected milos@mailspot.com, got %s %v", fwd, rvs, err)
+	}
+	rebound := strings.Replace(fwd, "@srs.", "@", 1)
+	if _, err := s.Reverse(rebound); err != srs.ErrHashInvalid {
+		t.Errorf("Reverse %s: expected %v, got %v", rebound, srs.ErrHashInvalid, err)
+	}
+}
+
+func TestLocalDomainSuffix(t *testing.T) {
+	for _, suffix := range []string{".example.com", "example.com"} {
+		s := srs.SRS{
+			Secret:            []byte(secret),
+			Domain:            localdomain,
+			LocalDomainSuffix: suffix,
+		}
+		for _, tc := range []struct {
+			email string
+			local bool
+		}{
+			{"milos@a.example.com", true},
+			{"milos@b.a.EXAMPLE.com", true},
+			{"milos@example.com", true},
+			{"milos@" + localdomain, true},
+			{"milos@evilexample.com", false},
+			{"milos@notexample.com", false},
+			{"milos@example.com.evil.net", false},
+		} {
+			fwd, err := s.Forward(tc.email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if local := fwd == tc.email; local != tc.local {
+				t.Errorf("Forward %s with suffix %s: expected local %v, got %s", tc.email, suffix, tc.local, fwd)
+			}
+		}
+	}
+}
+
+func TestCanForward(t *testing.T) {
+	stored := 0
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+		Store:  func(srsLocal, original string) { stored++ },
+	}
+
+	for _, email := range []string{
+		"milos@mailspot.com",
+		"milos@" + localdomain,
+		"milos@",
+		"milos",
+		"asdijaoisjd asidj oaisjd",
+		"milos@" + strings.Repeat("a", 1024) + ".com",
+		"SRS0=8Zzm@domain.com",
+		"SRS0=8Zzm=IS=netmark.rs=milos@domain.com",
+		"SRS1=50B9=domain.net==8Zzm=IS=netmark.rs=milos@domain.com",
+		"SRS1===@domain.com",
+	} {
+		canErr := s.CanForward(email)
+		if _, err := s.Forward(email); canErr != err {
+			t.Errorf("CanForward %s: expected %v like Forward, got %v", email, err, canErr)
+		}
+	}
+	if stats := s.Stats(); stats.Forwards+stats.ParseErrors != 10 {
+		t.Errorf("CanForward: expected only Forward calls to be counted, got %+v", stats)
+	}
+	if stored != 4 {
+		t.Errorf("CanForward: expected only Forward to store, got %d stored", stored)
+	}
+
+	s = srs.SRS{Secret: []byte(secret), Domain: localdomain, HashLength: 2}
+	if err := s.CanForward("milos@mailspot.com"); err != srs.ErrHashTooShortConfig {
+		t.Errorf("CanForward: expected %v, got %v", srs.ErrHashTooShortConfig, err)
+	}
+}
+
+func TestTruncateBeforeEncode(t *testing.T) {
+	// base64 is prefix stable, so hash is the same with all lengths, without
+	// zero padding of partially covered character
+	for _, hashLength := range []int{3, 4, 5, 6, 8, 9, 27} {
+		var hashes []string
+		for _, truncate := range []bool{false, true} {
+			s := srs.SRS{
+				Secret:               []byte(secret),
+				Domain:               localdomain,
+				HashLength:           hashLength,
+				TruncateBeforeEncode: truncate,
+			}
+			fwd, err := s.Forward("SRS0=8Zzm=IS=netmark.rs=milos@domain.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rvs, err := s.Reverse(fwd); err != nil || rvs != "SRS0=8Zzm=IS=netmark.rs=milos@domain.com" {
+				t.Errorf("Reverse %s: expected round trip, got %s %v", fwd, rvs, err)
+			}
+			hashes = append(hashes, fwd[5:5+hashLength])
+		}
+		if hashes[0] != hashes[1] {
+			t.Errorf("HashLength %d: expected the same hash, got %s and %s", hashLength, hashes[0], hashes[1])
+		}
+	}
+}
+
+func TestNoTimestamp(t *testing.T) {
+	now := time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC)
+	s := srs.SRS{
+		Secret:      []byte(secret),
+		Domain:      localdomain,
+		NoTimestamp: true,
+		NowFunc:     func() time.Time { return now },
+	}
+
+	for _, email := range []string{"milos@mailspot.com", "hello+world@domain.com", "a=b@domain.com"} {
+		fwd, err := s.Forward(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		local := email[:strings.LastIndex(email, "@")]
+		host := email[strings.LastIndex(email, "@")+1:]
+		if len(fwd) < 9 || fwd != "SRS0="+fwd[5:9]+"="+host+"="+local+"@"+localdomain {
+			t.Errorf("Forward %s: expected SRS0=hash=%s=%s, got %s", email, host, local, fwd)
+		}
+		if rvs, err := s.Reverse(fwd); err != nil || rvs != email {
+			t.Errorf("Reverse %s: expected %s, got %s %v", fwd, email, rvs, err)
+		}
+
+		// addresses never expire
+		later := s
+		later.NowFunc = func() time.Time { return now.AddDate(1, 0, 0) }
+		if rvs, err := later.Reverse(fwd); err != nil || rvs != email {
+			t.Errorf("Reverse %s a year later: expected %s, got %s %v", fwd, email, rvs, err)
+		}
+
+		// not compatible with default mode
+		plain := srs.SRS{Secret: []byte(secret), Domain: localdomain, NowFunc: s.NowFunc}
+		if rvs, err := plain.Reverse(fwd); err == nil {
+			t.Errorf("Reverse %s without NoTimestamp: expected error, got %s", fwd, rvs)
+		}
+	}
+
+	if _, err := s.Reverse("SRS0=abcd=mailspot.com@" + localdomain); err != srs.ErrNoUserSRS0 {
+		t.Errorf("Reverse: expected %v, got %v", srs.ErrNoUserSRS0, err)
+	}
+}
+
+func TestRejectExpiredInner(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 1, 0, 0, time.UTC) // time slot 2W
+	s := srs.SRS{
+		Secret:             []byte(secret),
+		Domain:             localdomain,
+		Lenient:            true,
+		RejectExpiredInner: true,
+		NowFunc:            func() time.Time { return now },
+	}
+
+	for _, tc := range []struct {
+		srs0 string
+		err  error
+	}{
+		{"SRS0=opaque+string@domain.com", nil},                                // no inner timestamp
+		{"SRS0=8Zzm=2W=netmark.rs=milos@domain.com", nil},                     // fresh
+		{"SRS0=8Zzm=2V=netmark.rs=milos@domain.com", nil},                     // day old
+		{"SRS0=8Zzm=I!=netmark.rs=milos@domain.com", nil},                     // can't be decoded
+		{"SRS0=8Zzm=ZX=netmark.rs=milos@domain.com", srs.ErrTimestampExpired}, // stale
+	} {
+		fwd, err := s.Forward(tc.srs0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rvs, err := s.Reverse(fwd)
+		if err != tc.err || err == nil && rvs != tc.srs0 {
+			t.Errorf("Reverse %s: expected %v, got %s %v", fwd, tc.err, rvs, err)
+		}
+
+		// inner timestamp is ignored by default
+		lax := s
+		lax.RejectExpiredInner = false
+		if rvs, err := lax.Reverse(fwd); err != nil || rvs != tc.srs0 {
+			t.Errorf("Reverse %s without RejectExpiredInner: expected %s, got %s %v", fwd, tc.srs0, rvs, err)
+		}
+	}
+}
+
+func TestRejectExpiredInnerRandomNonce(t *testing.T) {
+	minted := time.Date(2020, 1, 1, 0, 1, 0, 0, time.UTC)
+	now := minted
+	s := srs.SRS{
+		Secret:             []byte(secret),
+		Domain:             localdomain,
+		RandomNonce:        true,
+		RejectExpiredInner: true,
+		NowFunc:            func() time.Time { return now },
+	}
+	upstream := srs.SRS{
+		Secret:      []byte("upstream"),
+		Domain:      "upstream.com",
+		RandomNonce: true,
+		NowFunc:     func() time.Time { return minted },
+	}
+	srs0, err := upstream.Forward("milos@netmark.rs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fwd, err := s.Forward(srs0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rvs, err := s.Reverse(fwd); err != nil || rvs != srs0 {
+		t.Errorf("Reverse %s: expected %s, got %s %v", fwd, srs0, rvs, err)
+	}
+	now = minted.AddDate(0, 0, 30)
+	if rvs, err := s.Reverse(fwd); err != srs.ErrTimestampExpired {
+		t.Errorf("Reverse %s after 30 days: expected %v, got %s %v", fwd, srs.ErrTimestampExpired, rvs, err)
+	}
+}
+
+func TestSenderDomain(t *testing.T) {
+	s := srs.SRS{
+		Secret:  []byte(secret),
+		Domain:  localdomain,
+		Lenient: true,
+	}
+	srs0, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srs1, err := s.Forward("SRS0=8Zzm=IS=netmark.rs=milos@domain.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opaque, err := s.Forward("SRS0=opaque+string@domain.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		email  string
+		domain string
+		err    error
+	}{
+		{srs0, "mailspot.com", nil},
+		{srs1, "netmark.rs", nil},
+		{"SRS0=XXXX" + srs0[9:], "", srs.ErrHashInvalid},
+		{strings.Replace(srs1, "=netmark.rs=", "=evil.com=", 1), "", srs.ErrHashInvalid},
+		{opaque, "", srs.ErrNoUserSRS0},
+		{"milos@mailspot.com", "", srs.ErrNotSRS},
+	} {
+		domain, err := s.SenderDomain(tc.email)
+		if domain != tc.domain || err != tc.err {
+			t.Errorf("SenderDomain %s: expected %s %v, got %s %v", tc.email, tc.domain, tc.err, domain, err)
+		}
+	}
+}
+
+func TestRejectEmptyDomain(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	fwd, err := s.Forward("milos@")
+	if err != nil || !strings.HasSuffix(fwd, "==milos@"+localdomain) {
+		t.Errorf("Forward milos@: expected empty original domain, got %s %v", fwd, err)
+	}
+
+	s.RejectEmptyDomain = true
+	if fwd, err := s.Forward("milos@"); err != srs.ErrEmptyDomain {
+		t.Errorf("RejectEmptyDomain: expected %v, got %s %v", srs.ErrEmptyDomain, fwd, err)
+	}
+	if _, err := s.Forward("milos@mailspot.com"); err != nil {
+		t.Errorf("RejectEmptyDomain: %v", err)
+	}
+}
+
+func TestExtractAndReverse(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		text  string
+		orig  string
+		found bool
+		err   error
+	}{
+		{"Oct 16 10:00:00 mx postfix/smtp[123]: 4F2: to=<milos@mailspot.com>, from=<" + fwd + ">, status=bounced", "milos@mailspot.com", true, nil},
+		{"bounce for " + fwd + ".", "milos@mailspot.com", true, nil},
+		{"from=<SRS0=XXXX" + fwd[9:] + "> and " + fwd, "", true, srs.ErrHashInvalid},
+		{"Oct 16 10:00:00 mx postfix/smtp[123]: 4F2: to=<milos@mailspot.com>, status=sent", "", false, nil},
+		{"", "", false, nil},
+	} {
+		orig, found, err := s.ExtractAndReverse(tc.text)
+		if orig != tc.orig || found != tc.found || err != tc.err {
+			t.Errorf("ExtractAndReverse %q: expected %s %v %v, got %s %v %v", tc.text, tc.orig, tc.found, tc.err, orig, found, err)
+		}
+	}
+}
+
+func TestTimeEpoch(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := srs.SRS{
+		Secret:    []byte(secret),
+		Domain:    localdomain,
+		NowFunc:   func() time.Time { return now },
+		TimeEpoch: now.AddDate(0, 0, -5),
+	}
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts := strings.Split(fwd, "=")[2]; ts != "F" {
+		t.Errorf("TimeEpoch: expected timestamp F, got %s", ts)
+	}
+	if rev, err := s.Reverse(fwd); rev != "milos@mailspot.com" || err != nil {
+		t.Errorf("TimeEpoch reverse: expected milos@mailspot.com, got %s %v", rev, err)
+	}
+
+	def := srs.SRS{
+		Secret:  []byte(secret),
+		Domain:  localdomain,
+		NowFunc: s.NowFunc,
+	}
+	if rev, err := def.Reverse(fwd); err != srs.ErrTimestampExpired {
+		t.Errorf("TimeEpoch without epoch: expected %v, got %s %v", srs.ErrTimestampExpired, rev, err)
+	}
+
+	// first day of epoch is slot 0 encoded as A, not as empty timestamp
+	s.TimeEpoch = now
+	fwd, err = s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts := strings.Split(fwd, "=")[2]; ts != "A" || strings.Contains(fwd, "==") {
+		t.Errorf("TimeEpoch on day 0: expected timestamp A, got %s", fwd)
+	}
+	if rev, err := s.Reverse(fwd); rev != "milos@mailspot.com" || err != nil {
+		t.Errorf("TimeEpoch reverse on day 0: expected milos@mailspot.com, got %s %v", rev, err)
+	}
+}
+
+func TestFixedTimestampWidth(t *testing.T) {
+	for _, tc := range []struct {
+		day       int
+		timeSlots int
+		ts        string
+		fixed     string
+	}{
+		{5, 0, "F", "AF"},
+		{31, 0, "7", "A7"},
+		{32, 0, "BA", "BA"},
+		{1023, 0, "77", "77"},
+		{1024, 0, "A", "AA"},
+		{1024 + 1, 0, "B", "AB"},
+		{5, 32, "F", "F"},
+	} {
+		now := time.Unix(int64(tc.day)*24*60*60+3600, 0)
+		for _, fixed := range []bool{false, true} {
+			s := srs.SRS{
+				Secret:              []byte(secret),
+				Domain:              localdomain,
+				TimeSlots:           tc.timeSlots,
+				FixedTimestampWidth: fixed,
+				NowFunc:             func() time.Time { return now },
+			}
+			fwd, err := s.Forward("milos@mailspot.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := tc.ts
+			if fixed {
+				expected = tc.fixed
+			}
+			if ts := strings.Split(fwd, "=")[2]; ts != expected {
+				t.Errorf("Forward on day %d with fixed width %v: expected timestamp %s, got %s", tc.day, fixed, expected, fwd)
+			}
+			if slot, err := s.TimeSlot(fwd); slot != tc.day%1024 || err != nil {
+				t.Errorf("TimeSlot %s: expected %d, got %d %v", fwd, tc.day%1024, slot, err)
+			}
+			if rvs, err := s.Reverse(fwd); rvs != "milos@mailspot.com" || err != nil {
+				t.Errorf("Reverse %s: expected milos@mailspot.com, got %s %v", fwd, rvs, err)
+			}
+		}
+	}
+}
+
+func TestSeparators(t *testing.T) {
+	separators := srs.Separators()
+	if strings.Join(separators, "") != "=+-" {
+		t.Fatalf("Separators: expected =+-, got %v", separators)
+	}
+	separators[0] = "x" // callers can't change accepted separators
+	if srs.Separators()[0] != "=" {
+		t.Error("Separators: returned shared slice")
+	}
+
+	def := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	for _, email := range []string{"milos@mailspot.com", "SRS0=8Zzm=IS=netmark.rs=milos@domain.com"} {
+		var expected string
+		for _, sep := range srs.Separators() {
+			s := srs.SRS{
+				Secret:         []byte(secret),
+				Domain:         localdomain,
+				FirstSeparator: sep,
+			}
+			fwd, err := s.Forward(email)
+			if err != nil {
+				t.Fatalf("Forward %s with %s: %v", email, sep, err)
+			}
+			rev, err := def.Reverse(fwd)
+			if err != nil {
+				t.Errorf("Reverse %s: %v", fwd, err)
+			}
+			if expected == "" {
+				expected = rev
+			}
+			if rev != expected {
+				t.Errorf("Reverse %s: expected %s, got %s", fwd, expected, rev)
+			}
+		}
+	}
+}
+
+func TestReverseQuarantine(t *testing.T) {
+	minted := time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC)
+	now := minted
+	s := srs.SRS{
+		Secret:  []byte(secret),
+		Domain:  localdomain,
+		NowFunc: func() time.Time { return now },
+	}
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srs1, err := s.Forward("SRS0=8Zzm=IS=netmark.rs=milos@domain.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		email   string
+		days    int
+		orig    string
+		expired bool
+		err     error
+	}{
+		{fwd, 0, "milos@mailspot.com", false, nil},
+		{fwd, 21, "milos@mailspot.com", false, nil},
+		{fwd, 22, "milos@mailspot.com", true, nil},
+		{fwd, 500, "milos@mailspot.com", true, nil},
+		{srs1, 0, "SRS0=8Zzm=IS=netmark.rs=milos@domain.com", false, nil},
+		{"SRS0=XXXX" + fwd[9:], 0, "", false, srs.ErrHashInvalid},
+		{"SRS0=XXXX" + fwd[9:], 500, "", false, srs.ErrHashInvalid},
+		{"milos@mailspot.com", 0, "", false, srs.ErrNotSRS},
+	} {
+		now = minted.AddDate(0, 0, tc.days)
+		orig, expired, err := s.ReverseQuarantine(tc.email)
+		if orig != tc.orig || expired != tc.expired || err != tc.err {
+			t.Errorf("ReverseQuarantine %s after %d days: expected %s %v %v, got %s %v %v", tc.email, tc.days, tc.orig, tc.expired, tc.err, orig, expired, err)
+		}
+	}
+}
+
+func TestShortSRS1(t *testing.T) {
+	s := srs.SRS{
+		Secret:     []byte(secret),
+		Domain:     localdomain,
+		HashLength: 3,
+		Prefixes:   srs.Prefixes{SRS0: "S0", SRS1: "S1"},
+	}
+	foreign := "S0=8Zz=IS=netmark.rs=milos@b"
+	fwd, err := s.Forward(foreign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first := fwd[:strings.Index(fwd, "==")]; len(first) != 8 {
+		t.Fatalf("Forward: expected SRS1 prefix, hash and host in 8 characters, got %s", fwd)
+	}
+	if rvs, err := s.Reverse(fwd); err != nil || rvs != foreign {
+		t.Errorf("Reverse %s: expected %s, got %s %v", fwd, foreign, rvs, err)
+	}
+	if _, err := s.Reverse("S1=ab==8Zz=IS=netmark.rs=milos@" + localdomain); err != srs.ErrHashTooShort {
+		t.Errorf("Reverse: expected %v, got %v", srs.ErrHashTooShort, err)
+	}
+}
+
+func TestNormalizeReverseSeparator(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	foreign := "SRS0+8Zzm=IS=netmark.rs=milos@domain.com"
+	fwd, err := s.Forward(foreign)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rvs, err := s.Reverse(fwd); err != nil || rvs != foreign {
+		t.Errorf("Reverse %s: expected %s, got %s %v", fwd, foreign, rvs, err)
+	}
+
+	s.NormalizeReverseSeparator = true
+	expected := "SRS0=8Zzm=IS=netmark.rs=milos@domain.com"
+	if rvs, err := s.Reverse(fwd); err != nil || rvs != expected {
+		t.Errorf("NormalizeReverseSeparator %s: expected %s, got %s %v", fwd, expected, rvs, err)
+	}
+
+	s = srs.SRS{
+		Secret:                    []byte(secret),
+		Domain:                    localdomain,
+		FirstSeparator:            "-",
+		NormalizeReverseSeparator: true,
+	}
+	expected = "SRS0-8Zzm=IS=netmark.rs=milos@domain.com"
+	if rvs, err := s.Reverse(fwd); err != nil || rvs != expected {
+		t.Errorf("NormalizeReverseSeparator %s: expected %s, got %s %v", fwd, expected, rvs, err)
+	}
+}
+
+func TestForwardSMTPSafe(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	for _, tc := range []struct {
+		email string
+		ok    bool
+	}{
+		{"milos@mailspot.com", true},
+		{"\"milos m\"@mailspot.com", false},
+		{"\"milos\tm\"@mailspot.com", false},
+		{"\"milos<m>\"@mailspot.com", false},
+		{"\"a@b\"@mailspot.com", false},
+		{"\"a\\\"b\"@mailspot.com", false},
+		{"\"a..b\"@mailspot.com", false},
+		{"milos@mailspot.com\r\n", false},
+		{"milos\r\n@mailspot.com", false},
+	} {
+		// quoted local parts are ErrUnsafeAddress, or ErrBadFormat with srs_nomail
+		fwd, err := s.Forward(tc.email)
+		if (err == nil) != tc.ok || err != nil && err != srs.ErrUnsafeAddress && err != srs.ErrBadFormat {
+			t.Errorf("Forward %q: unexpected result %q %v", tc.email, fwd, err)
+		}
+		if strings.ContainsAny(fwd, " \t\r\n<>") {
+			t.Errorf("Forward %q: unsafe address %q", tc.email, fwd)
+		}
+	}
+}
+
+func TestMaxAgeForDomain(t *testing.T) {
+	minted := time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC)
+	now := minted
+	s := srs.SRS{
+		Secret:  []byte(secret),
+		Domain:  localdomain,
+		MaxAge:  14,
+		NowFunc: func() time.Time { return now },
+		MaxAgeForDomain: func(origDomain string) int {
+			if origDomain == "slow.com" {
+				return 60
+			}
+			return 0
+		},
+	}
+	slow, err := s.Forward("milos@slow.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		days    int
+		slowErr error
+		fastErr error
+	}{
+		{10, nil, nil},
+		{14, nil, nil},
+		{15, nil, srs.ErrTimestampExpired},
+		{30, nil, srs.ErrTimestampExpired},
+		{60, nil, srs.ErrTimestampExpired},
+		{61, srs.ErrTimestampExpired, srs.ErrTimestampExpired},
+	} {
+		now = minted.AddDate(0, 0, tc.days)
+		if _, err := s.Reverse(slow); err != tc.slowErr {
+			t.Errorf("Reverse slow.com after %d days: expected %v, got %v", tc.days, tc.slowErr, err)
+		}
+		if _, err := s.Reverse(fast); err != tc.fastErr {
+			t.Errorf("Reverse mailspot.com after %d days: expected %v, got %v", tc.days, tc.fastErr, err)
+		}
+	}
+
+	bad := srs.SRS{Secret: []byte(secret), Domain: localdomain, MaxAge: 1024}
+	if err := bad.Validate(); err != srs.ErrMaxAgeConfig {
+		t.Errorf("Validate: expected %v, got %v", srs.ErrMaxAgeConfig, err)
+	}
+}
+
+func TestLegacyTimeSlots(t *testing.T) {
+	// day 600 is slot 600 in cycle of 1024 days and slot 88 in cycle of 512 days
+	minted := time.Unix(600*24*60*60+3600, 0)
+	now := minted
+	old := srs.SRS{Secret: []byte(secret), Domain: localdomain, NowFunc: func() time.Time { return now }}
+	fwd, err := old.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srs.SRS{Secret: []byte(secret), Domain: localdomain, TimeSlots: 512, NowFunc: func() time.Time { return now }}
+	if _, err := s.Reverse(fwd); err != srs.ErrTimestampExpired {
+		t.Errorf("Reverse %s without legacy time slots: expected %v, got %v", fwd, srs.ErrTimestampExpired, err)
+	}
+
+	s = srs.SRS{Secret: []byte(secret), Domain: localdomain, TimeSlots: 512, LegacyTimeSlots: []int{1024}, NowFunc: func() time.Time { return now }}
+	for _, tc := range []struct {
+		days int
+		err  error
+	}{
+		{0, nil},
+		{21, nil},
+		{22, srs.ErrTimestampExpired},
+	} {
+		now = minted.AddDate(0, 0, tc.days)
+		if orig, err := s.Reverse(fwd); err != tc.err || err == nil && orig != "milos@mailspot.com" {
+			t.Errorf("Reverse %s after %d days: expected %v, got %s %v", fwd, tc.days, tc.err, orig, err)
+		}
+	}
+
+	// addresses forwarded with new time slots are still reversed
+	now = minted
+	fwd, err = s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = minted.AddDate(0, 0, 21)
+	if orig, err := s.Reverse(fwd); err != nil || orig != "milos@mailspot.com" {
+		t.Errorf("Reverse %s: got %s %v", fwd, orig, err)
+	}
+
+	for _, bad := range []srs.SRS{
+		{Secret: []byte(secret), Domain: localdomain, TimeSlots: 2048},
+		{Secret: []byte(secret), Domain: localdomain, LegacyTimeSlots: []int{0}},
+	} {
+		if err := bad.Validate(); err != srs.ErrTimeSlotsConfig {
+			t.Errorf("Validate %v %v: expected %v, got %v", bad.TimeSlots, bad.LegacyTimeSlots, srs.ErrTimeSlotsConfig, err)
+		}
+	}
+	bad := srs.SRS{Secret: []byte(secret), Domain: localdomain, TimeSlots: 21}
+	if err := bad.Validate(); err != srs.ErrMaxAgeConfig {
+		t.Errorf("Validate TimeSlots 21: expected %v, got %v", srs.ErrMaxAgeConfig, err)
+	}
+}
+
+func TestRandomNonce(t *testing.T) {
+	s := srs.SRS{
+		Secret:      []byte(secret),
+		Domain:      localdomain,
+		RandomNonce: true,
+		CacheSize:   10,
+	}
+	fwd1, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fwd2, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fwd1 == fwd2 {
+		t.Errorf("RandomNonce: expected different addresses, got %s twice", fwd1)
+	}
+
+	for _, fwd := range []string{fwd1, fwd2} {
+		if rvs, err := s.Reverse(fwd); rvs != "milos@mailspot.com" || err != nil {
+			t.Errorf("Reverse %s: expected milos@mailspot.com, got %s %v", fwd, rvs, err)
+		}
+		if _, err := s.TimeSlot(fwd); err != nil {
+			t.Errorf("TimeSlot %s: %v", fwd, err)
+		}
+
+		// nonce is covered by hash
+		f := strings.Split(fwd, "=")
+		nonce := "AAAA"
+		if strings.HasSuffix(f[2], nonce) {
+			nonce = "BBBB"
+		}
+		f[2] = f[2][:len(f[2])-len(nonce)] + nonce
+		if _, err := s.Reverse(strings.Join(f, "=")); err != srs.ErrHashInvalid {
+			t.Errorf("Reverse with changed nonce: expected %v, got %v", srs.ErrHashInvalid, err)
+		}
+	}
+
+	def := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	if _, err := def.Reverse(fwd1); err == nil {
+		t.Errorf("Reverse %s without RandomNonce: expected error", fwd1)
+	}
+	if _, err := s.Reverse("SRS0=8Zzm=IS=netmark.rs=milos@" + localdomain); err != srs.ErrTimestampInvalidBase32 {
+		t.Errorf("Reverse without nonce: expected %v, got %v", srs.ErrTimestampInvalidBase32, err)
+	}
+}
+
+func TestRandomNonceNoTimestamp(t *testing.T) {
+	s := srs.SRS{
+		Secret:      []byte(secret),
+		Domain:      localdomain,
+		RandomNonce: true,
+		NoTimestamp: true,
+	}
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rvs, err := s.Reverse(fwd); rvs != "milos@mailspot.com" || err != nil {
+		t.Errorf("Reverse %s: expected milos@mailspot.com, got %s %v", fwd, rvs, err)
+	}
+}
+
+func TestQuotedAtSign(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	// original local part with at sign can't be forwarded unquoted, ErrBadFormat with srs_nomail
+	if fwd, err := s.Forward(`"a@b"@mailspot.com`); err != srs.ErrUnsafeAddress && err != srs.ErrBadFormat {
+		t.Errorf("Forward \"a@b\"@mailspot.com: expected error, got %s %v", fwd, err)
+	}
+
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, domain, err := srs.SplitSRS(`"` + strings.Replace(fwd, "@", `"@`, 1))
+	if err != nil || local+"@"+domain != fwd {
+		t.Fatalf("SplitSRS quoted %s: unexpected %s %s %v", fwd, local, domain, err)
+	}
+}
+
+func TestBindForwardingDomain(t *testing.T) {
+	for _, bind := range []bool{false, true} {
+		a := srs.SRS{
+			Secret:               []byte(secret),
+			Domain:               "a.example.com",
+			BindForwardingDomain: bind,
+		}
+		b := srs.SRS{
+			Secret:               []byte(secret),
+			Domain:               "b.example.com",
+			BindForwardingDomain: bind,
+		}
+
+		for _, email := range []string{"milos@mailspot.com", "SRS0=8Zzm=IS=netmark.rs=milos@domain.com"} {
+			fwd, err := a.Forward(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rvs, err := a.Reverse(fwd); rvs != email || err != nil {
+				t.Errorf("Reverse %s at A: expected %s, got %s %v", fwd, email, rvs, err)
+			}
+
+			// replayed through forwarder B with shared secret
+			rvs, err := b.Reverse(fwd)
+			if bind && err != srs.ErrHashInvalid {
+				t.Errorf("Reverse %s at B: expected %v, got %s %v", fwd, srs.ErrHashInvalid, rvs, err)
+			}
+			if !bind && (rvs != email || err != nil) {
+				t.Errorf("Reverse %s at B without BindForwardingDomain: expected %s, got %s %v", fwd, email, rvs, err)
+			}
+		}
+	}
+}
+
+func TestRejectSRS1(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	srs0, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srs1, err := s.Forward("SRS0=8Zzm=IS=netmark.rs=milos@domain.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign := "SRS1=XXXX=domain.com==8Zzm=IS=netmark.rs=milos@fwd.com"
+
+	s.RejectSRS1 = true
+	if rvs, err := s.Reverse(srs0); rvs != "milos@mailspot.com" || err != nil {
+		t.Errorf("Reverse %s: expected milos@mailspot.com, got %s %v", srs0, rvs, err)
+	}
+	if rvs, err := s.Reverse(srs1); err != srs.ErrSRS1Rejected {
+		t.Errorf("Reverse %s: expected %v, got %s %v", srs1, srs.ErrSRS1Rejected, rvs, err)
+	}
+	if fwd, err := s.Forward(foreign); err != srs.ErrSRS1Rejected {
+		t.Errorf("Forward %s: expected %v, got %s %v", foreign, srs.ErrSRS1Rejected, fwd, err)
+	}
+	if fwd, err := s.Forward("SRS0=8Zzm=IS=netmark.rs=milos@domain.com"); err != nil || fwd != srs1 {
+		t.Errorf("Forward SRS0: expected %s, got %s %v", srs1, fwd, err)
+	}
+
+	s.KeepSRS1 = true
+	if fwd, err := s.Forward(foreign); err != nil || fwd != foreign {
+		t.Errorf("Forward %s with KeepSRS1: expected unchanged, got %s %v", foreign, fwd, err)
+	}
+}
+
+func TestStrictSRS1(t *testing.T) {
+	first := srs.SRS{Secret: []byte(secret), Domain: "first.com"}
+	srs0, err := first.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// inner hash corrupted by the first hop, outer hash is valid
+	badInner := "SRS0=XXXX=" + strings.SplitN(srs0, "=", 3)[2]
+
+	s := srs.SRS{Secret: []byte(secret), Domain: localdomain}
+	strict := srs.SRS{Secret: []byte(secret), Domain: localdomain, StrictSRS1: true}
+	srs1, err := s.Forward(srs0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srs1BadInner, err := s.Forward(badInner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srs1BadOuter := "SRS1=XXXX=" + strings.SplitN(srs1, "=", 3)[2]
+
+	for _, tc := range []struct {
+		email     string
+		err       error
+		strictErr error
+	}{
+		{srs1, nil, nil},
+		{srs1BadInner, nil, srs.ErrSRS0HashInvalid},
+		{srs1BadOuter, srs.ErrHashInvalid, srs.ErrSRS1HashInvalid},
+	} {
+		if _, err := s.Reverse(tc.email); err != tc.err {
+			t.Errorf("Reverse %s: expected %v, got %v", tc.email, tc.err, err)
+		}
+		if _, err := strict.Reverse(tc.email); err != tc.strictErr {
+			t.Errorf("Reverse %s with StrictSRS1: expected %v, got %v", tc.email, tc.strictErr, err)
+		}
+	}
+	if rvs, err := strict.Reverse(srs1); rvs != srs0 || err != nil {
+		t.Errorf("Reverse %s with StrictSRS1: expected %s, got %s %v", srs1, srs0, rvs, err)
+	}
+}
+
+func TestOnNearExpiry(t *testing.T) {
+	minted := time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC)
+	now := minted
+	var notified string
+	var remaining time.Duration
+	s := srs.SRS{
+		Secret:  []byte(secret),
+		Domain:  localdomain,
+		NowFunc: func() time.Time { return now },
+		OnNearExpiry: func(email string, r time.Duration) {
+			notified, remaining = email, r
+		},
+	}
+	fwd, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		days       int
+		nearExpiry time.Duration
+		remaining  time.Duration
+	}{
+		{0, 0, 0},
+		{20, 0, 0},
+		{21, 0, 12 * time.Hour},
+		{20, 48 * time.Hour, 36 * time.Hour},
+		{22, 0, 0}, // expired
+	} {
+		now = minted.AddDate(0, 0, tc.days)
+		s.NearExpiry = tc.nearExpiry
+		notified, remaining = "", 0
+		s.Reverse(fwd)
+		if remaining != tc.remaining || (notified == fwd) != (tc.remaining != 0) {
+			t.Errorf("OnNearExpiry after %d days: expected %v, got %q %v", tc.days, tc.remaining, notified, remaining)
+		}
+	}
+}
+
+func TestInstanceSalt(t *testing.T) {
+	newEngine := func(salt string) *srs.SRS {
+		s := &srs.SRS{
+			Secret: []byte(secret),
+			Domain: localdomain,
+		}
+		if salt != "" {
+			s.InstanceSalt = []byte(salt)
+		}
+		return s
+	}
+	a, b, a2, plain := newEngine("instance-a"), newEngine("instance-b"), newEngine("instance-a"), newEngine("")
+
+	for _, email := range []string{"milos@mailspot.com", "SRS0=8Zzm=IS=netmark.rs=milos@domain.com"} {
+		fwd, err := a.Forward(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rvs, err := a2.Reverse(fwd); rvs != email || err != nil {
+			t.Errorf("Reverse %s with the same salt: expected %s, got %s %v", fwd, email, rvs, err)
+		}
+		if rvs, err := b.Reverse(fwd); err != srs.ErrHashInvalid {
+			t.Errorf("Reverse %s with other salt: expected %v, got %s %v", fwd, srs.ErrHashInvalid, rvs, err)
+		}
+		if rvs, err := plain.Reverse(fwd); err != srs.ErrHashInvalid {
+			t.Errorf("Reverse %s without salt: expected %v, got %s %v", fwd, srs.ErrHashInvalid, rvs, err)
+		}
+
+		fwd, err = b.Forward(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rvs, err := a.Reverse(fwd); err != srs.ErrHashInvalid {
+			t.Errorf("Reverse %s with other salt: expected %v, got %s %v", fwd, srs.ErrHashInvalid, rvs, err)
+		}
+	}
+}
+
+func TestInstanceSaltReplay(t *testing.T) {
+	salted := srs.SRS{Secret: []byte(secret), Domain: localdomain, InstanceSalt: []byte("x")}
+	plain := srs.SRS{Secret: []byte(secret), Domain: localdomain}
+	fwd, err := salted.Forward("SRS0=8Zzm=IS=netmark.rs=milos@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// salt moved to the beginning of host
+	replayed := strings.Replace(fwd, "=example.com==", "=xexample.com==", 1)
+	if rvs, err := plain.Reverse(replayed); err != srs.ErrHashInvalid {
+		t.Errorf("Reverse %s without salt: expected %v, got %s %v", replayed, srs.ErrHashInvalid, rvs, err)
+	}
+}
+
+func TestReverseAt(t *testing.T) {
+	minted := time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC)
+	old := srs.SRS{
+		Secret:  []byte(secret),
+		Domain:  localdomain,
+		NowFunc: func() time.Time { return minted },
+	}
+	fwd, err := old.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := srs.SRS{
+		Secret:  []byte(secret),
+		Domain:  localdomain,
+		NowFunc: func() time.Time { return minted.AddDate(0, 0, 100) },
+	}
+	if _, err := s.Reverse(fwd); err != srs.ErrTimestampExpired {
+		t.Fatalf("Reverse %s: expected %v, got %v", fwd, srs.ErrTimestampExpired, err)
+	}
+
+	for _, tc := range []struct {
+		at  time.Time
+		err error
+	}{
+		{minted, nil},
+		{minted.AddDate(0, 0, 21), nil},
+		{minted.AddDate(0, 0, 22), srs.ErrTimestampExpired},
+	} {
+		rvs, err := s.ReverseAt(fwd, tc.at)
+		if err != tc.err || err == nil && rvs != "milos@mailspot.com" {
+			t.Errorf("ReverseAt %s at %s: expected %v, got %s %v", fwd, tc.at, tc.err, rvs, err)
+		}
+	}
+
+	// NowFunc of the engine is unchanged
+	if _, err := s.Reverse(fwd); err != srs.ErrTimestampExpired {
+		t.Errorf("Reverse %s after ReverseAt: expected %v, got %v", fwd, srs.ErrTimestampExpired, err)
+	}
+}
+
+func TestReseparate(t *testing.T) {
+	old := srs.SRS{Secret: []byte(secret), Domain: localdomain}
+	s := srs.SRS{Secret: []byte(secret), Domain: localdomain, FirstSeparator: "-"}
+
+	for _, tc := range []struct {
+		email  string
+		prefix string
+	}{
+		{"milos@mailspot.com", "SRS0-"},
+		{"SRS0=8Zzm=IS=netmark.rs=milos@domain.com", "SRS1-"},
+	} {
+		fwd, err := old.Forward(tc.email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conv, err := s.Reseparate(fwd)
+		if err != nil || !strings.HasPrefix(conv, tc.prefix) {
+			t.Errorf("Reseparate %s: expected %s address, got %s %v", fwd, tc.prefix, conv, err)
+			continue
+		}
+		for _, addr := range []string{fwd, conv} {
+			if rvs, err := s.Reverse(addr); rvs != tc.email || err != nil {
+				t.Errorf("Reverse %s: expected %s, got %s %v", addr, tc.email, rvs, err)
+			}
+		}
+	}
+
+	fwd, err := old.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := "SRS0=XXXX=" + strings.SplitN(fwd, "=", 3)[2]
+	if conv, err := s.Reseparate(forged); err != srs.ErrHashInvalid {
+		t.Errorf("Reseparate %s: expected %v, got %s %v", forged, srs.ErrHashInvalid, conv, err)
+	}
+	if conv, err := s.Reseparate("milos@mailspot.com"); err != srs.ErrNotSRS {
+		t.Errorf("Reseparate milos@mailspot.com: expected %v, got %s %v", srs.ErrNotSRS, conv, err)
+	}
+}
+
+func TestUppercaseHash(t *testing.T) {
+	for _, tag := range []byte{0, 'x'} {
+		s := srs.SRS{
+			Secret:        []byte(secret),
+			Domain:        localdomain,
+			SchemeTag:     tag,
+			UppercaseHash: true,
+		}
+		def := srs.SRS{
+			Secret:    []byte(secret),
+			Domain:    localdomain,
+			SchemeTag: tag,
+		}
+
+		for _, email := range []string{"milos@mailspot.com", "SRS0=8Zzm=IS=netmark.rs=milos@domain.com"} {
+			fwd, err := s.Forward(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash := strings.Split(fwd, "=")[1]
+			if hash != strings.ToUpper(hash) {
+				t.Errorf("Forward %s: expected uppercase hash, got %s", email, fwd)
+			}
+			for _, e := range []*srs.SRS{&s, &def} {
+				if rvs, err := e.Reverse(fwd); rvs != email || err != nil {
+					t.Errorf("Reverse %s: expected %s, got %s %v", fwd, email, rvs, err)
+				}
+			}
+		}
+	}
+}
+
+func TestWouldRewrite(t *testing.T) {
+	s := srs.SRS{
+		Secret:     []byte(secret),
+		Domain:     localdomain,
+		AltDomains: []string{"alt.example.com"},
+	}
+	for _, tc := range []struct {
+		email   string
+		rewrite bool
+		err     error
+	}{
+		{"milos@" + localdomain, false, nil},
+		{"milos@ALT.example.com", false, nil},
+		{"SRS0=8Zzm=IS=netmark.rs=milos@" + localdomain, false, nil},
+		{"milos@mailspot.com", true, nil},
+		{"SRS0=8Zzm=IS=netmark.rs=milos@domain.com", true, nil},
+		{"milos@", true, nil},
+		{"milos", false, srs.ErrNoAtSign},
+		{"milos@domain,net", false, srs.ErrBadFormat},
+	} {
+		rewrite, err := s.WouldRewrite(tc.email)
+		if rewrite != tc.rewrite || err != tc.err {
+			t.Errorf("WouldRewrite %s: expected %v %v, got %v %v", tc.email, tc.rewrite, tc.err, rewrite, err)
+		}
+
+		// Forward agrees
+		fwd, err := s.Forward(tc.email)
+		if tc.err == nil && (err != nil || (fwd != tc.email) != tc.rewrite) {
+			t.Errorf("Forward %s: got %s %v, WouldRewrite %v", tc.email, fwd, err, tc.rewrite)
+		}
+	}
+
+	for _, e := range []srs.SRS{
+		{Secret: []byte(secret), Domain: localdomain, KeepSRS1: true},
+		{Secret: []byte(secret), Domain: localdomain, RejectSRS1: true},
+		{Secret: []byte(secret), Domain: localdomain, RejectEmptyDomain: true},
+	} {
+		for _, email := range []string{
+			"milos@mailspot.com",
+			"milos@",
+			"SRS1=50B9=domain.net==8Zzm=IS=netmark.rs=milos@domain.com",
+		} {
+			rewrite, err := e.WouldRewrite(email)
+			fwd, fwdErr := e.Forward(email)
+			if err != fwdErr || err == nil && rewrite != (fwd != email) {
+				t.Errorf("WouldRewrite %s: got %v %v, Forward %s %v", email, rewrite, err, fwd, fwdErr)
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package srs
+
+import "sync/atomic"
+
+// Stats is snapshot of engine counters
+type Stats struct {
+	Forwards          uint64 // successful Forward calls
+	Reverses          uint64 // successful Reverse calls
+	HashFailures      uint64 // invalid hash on reverse
+	TimestampFailures uint64 // out of date or bad timestamp on reverse
+	NotSRS            uint64 // reverse of non SRS address or address at foreign domain
+	ParseErrors       uint64 // bad email or SRS address format
+}
+
+// counters updated atomically by Forward and Reverse
+type counters struct {
+	forwards          uint64
+	reverses          uint64
+	hashFailures      uint64
+	timestampFailures uint64
+	notSRS            uint64
+	parseErrors       uint64
+}
+
+// count increments success counter if err is nil or failure counter for err
+func (c *counters) count(err error, success *uint64) {
+	switch err {
+	case nil:
+		atomic.AddUint64(success, 1)
+	case ErrHashInvalid, ErrSRS1HashInvalid, ErrSRS0HashInvalid:
+		atomic.AddUint64(&c.hashFailures, 1)
+	case ErrTimestampExpired, ErrTimestampInvalidBase32:
+		atomic.AddUint64(&c.timestampFailures, 1)
+	case ErrNotSRS, ErrWrongDomain:
+		atomic.AddUint64(&c.notSRS, 1)
+	case ErrNoAtSign, ErrBadFormat, ErrBadURLEncoding, ErrInputTooLong, ErrImplausibleFields,
+		ErrEmptyDomain, ErrUnsafeAddress, ErrUnsupportedVersion, ErrNoUserSRS0, ErrNoUserSRS1, ErrHashTooShort:
+		atomic.AddUint64(&c.parseErrors, 1)
+	}
+}
+
+// Stats returns snapshot of Forward and Reverse counters
+func (srs *SRS) Stats() Stats {
+	srs.setDefaults()
+	c := srs.stats
+	return Stats{
+		Forwards:          atomic.LoadUint64(&c.forwards),
+		Reverses:          atomic.LoadUint64(&c.reverses),
+		HashFailures:      atomic.LoadUint64(&c.hashFailures),
+		TimestampFailures: atomic.LoadUint64(&c.timestampFailures),
+		NotSRS:            atomic.LoadUint64(&c.notSRS),
+		ParseErrors:       atomic.LoadUint64(&c.parseErrors),
+	}
+}
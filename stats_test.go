@@ -0,0 +1,52 @@
+package srs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mileusna/srs"
+)
+
+func TestStats(t *testing.T) {
+	s := srs.SRS{
+		Secret: []byte(secret),
+		Domain: localdomain,
+	}
+	if stats := s.Stats(); stats != (srs.Stats{}) {
+		t.Errorf("Stats: expected zero counters, got %+v", stats)
+	}
+
+	old := srs.SRS{
+		Secret:  []byte(secret),
+		Domain:  localdomain,
+		NowFunc: func() time.Time { return time.Now().AddDate(0, 0, -30) },
+	}
+	expired, _ := old.Forward("milos@mailspot.com")
+
+	fwd, _ := s.Forward("milos@mailspot.com")
+	s.Forward("SRS0=8Zzm=IS=netmark.rs=milos@domain.com")
+	s.Forward("milos@" + localdomain)
+	s.Forward("milos")                // parse error
+	s.Forward("SRS0=8Zzm@domain.com") // parse error
+
+	s.Reverse(fwd)
+	s.ReverseHeader("<" + fwd + ">")
+	s.Reverse("SRS0=XXXX" + fwd[9:])                                           // hash failure
+	s.Reverse(expired)                                                         // timestamp failure
+	s.Reverse("SRS0=8Zzm=I1=netmark.rs=milos@" + localdomain)                  // timestamp failure
+	s.Reverse("milos@mailspot.com")                                            // not SRS
+	s.Reverse("SRS1=wtfisthis=milos@" + localdomain)                           // parse error
+	s.Reverse("SRS1=XXXX=domain.com==8Zzm=IS=netmark.rs=milos@" + localdomain) // hash failure
+
+	expected := srs.Stats{
+		Forwards:          3,
+		Reverses:          2,
+		HashFailures:      2,
+		TimestampFailures: 2,
+		NotSRS:            1,
+		ParseErrors:       3,
+	}
+	if stats := s.Stats(); stats != expected {
+		t.Errorf("Stats: expected %+v, got %+v", expected, stats)
+	}
+}
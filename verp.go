@@ -0,0 +1,116 @@
+package srs
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// VERP errors
+var (
+	ErrNoVERP           = errors.New("No VERP recipient in address") // returned by ReverseVERP for address without VERP recipient
+	ErrVERPNotRewritten = errors.New("Address not rewritten, VERP recipient can't be added")
+)
+
+// ForwardVERP returns SRS forward address of email with recipient encoded in
+// local part in VERP form, like SRS0=hash=ts=host=user+rcpt=example.com@Domain.
+// Recipient local part and host are xtext encoded, so + and = in recipient
+// don't break decoding. Use ReverseVERP on bounces to get both addresses back.
+// Address which Forward doesn't rewrite, like address at Domain, returns
+// ErrVERPNotRewritten, since ReverseVERP couldn't decode it.
+func (srs *SRS) ForwardVERP(email, recipient string) (string, error) {
+	rcptLocal, rcptHost, err := parseEmail(recipient)
+	if err != nil {
+		return "", err
+	}
+
+	fwd, err := srs.Forward(email)
+	if err != nil {
+		return "", err
+	}
+
+	if fwd == email {
+		return "", ErrVERPNotRewritten
+	}
+
+	at := strings.LastIndex(fwd, "@")
+	out := fwd[:at] + "+" + xtext(rcptLocal) + sep + xtext(rcptHost) + fwd[at:]
+	if len(out) > srs.MaxInputLength {
+		return "", ErrInputTooLong
+	}
+	return out, nil
+}
+
+// ReverseVERP reverses address returned by ForwardVERP to original address and
+// VERP encoded recipient. SRS user may contain + too, so the VERP boundary is
+// the one for which SRS hash is valid.
+func (srs *SRS) ReverseVERP(email string) (orig, recipient string, err error) {
+	if err := srs.setDefaults(); err != nil {
+		return "", "", err
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at == -1 {
+		return "", "", ErrNoAtSign
+	}
+	local, domain := email[:at], email[at:]
+
+	err = ErrNoVERP
+	for i := strings.LastIndex(local, "+"); i > 0; i = strings.LastIndex(local[:i], "+") {
+		rcpt, ok := verpRecipient(local[i+1:])
+		if !ok {
+			continue
+		}
+		rvs, _, rvsErr := srs.reverseAddress(local[:i]+domain, 0)
+		if rvsErr == nil {
+			srs.stats.count(nil, &srs.stats.reverses)
+			rvs, _ = srs.unicodeAddress(rvs)
+			return rvs, rcpt, nil
+		}
+		// hash is invalid at wrong boundary, so other errors are more telling
+		if err == ErrNoVERP || err == ErrHashInvalid {
+			err = rvsErr
+		}
+	}
+
+	srs.stats.count(err, &srs.stats.reverses)
+	return "", "", err
+}
+
+// verpRecipient decodes xtext encoded VERP recipient local=host
+func verpRecipient(verp string) (string, bool) {
+	i := strings.Index(verp, sep)
+	if i <= 0 || i == len(verp)-1 || strings.Count(verp, sep) != 1 {
+		return "", false
+	}
+	local, ok := unxtext(verp[:i])
+	if !ok {
+		return "", false
+	}
+	host, ok := unxtext(verp[i+1:])
+	if !ok {
+		return "", false
+	}
+	return local + "@" + host, true
+}
+
+// unxtext decodes xtext string, RFC 3461, section 4
+func unxtext(s string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '+' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) {
+			return "", false
+		}
+		c, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+		if err != nil || strings.ToUpper(s[i+1:i+3]) != s[i+1:i+3] {
+			return "", false
+		}
+		b.WriteByte(byte(c))
+		i += 2
+	}
+	return b.String(), true
+}
@@ -0,0 +1,80 @@
+package srs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mileusna/srs"
+)
+
+func TestVERP(t *testing.T) {
+	now := time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC)
+	s := srs.SRS{
+		Secret:  []byte(secret),
+		Domain:  localdomain,
+		NowFunc: func() time.Time { return now },
+	}
+
+	for _, tc := range []struct {
+		email     string
+		recipient string
+	}{
+		{"milos@mailspot.com", "member@lists.example.com"},
+		{"hello+world@domain.com", "member+tag@lists.example.com"},
+		{"milos@mailspot.com", "a=b+c@lists.example.com"},
+		{"SRS0=8Zzm=IS=netmark.rs=milos@domain.com", "member@lists.example.com"},
+	} {
+		fwd, err := s.ForwardVERP(tc.email, tc.recipient)
+		if err != nil {
+			t.Errorf("ForwardVERP %s %s: %v", tc.email, tc.recipient, err)
+			continue
+		}
+		orig, rcpt, err := s.ReverseVERP(fwd)
+		if err != nil || orig != tc.email || rcpt != tc.recipient {
+			t.Errorf("ReverseVERP %s: expected %s %s, got %s %s %v", fwd, tc.email, tc.recipient, orig, rcpt, err)
+		}
+	}
+
+	fwd, err := s.ForwardVERP("hello+world@domain.com", "member@lists.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "SRS0=" + fwd[5:9] + "=ID=domain.com=hello+world+member=lists.example.com@" + localdomain; fwd != expected {
+		t.Errorf("ForwardVERP: expected %s, got %s", expected, fwd)
+	}
+
+	// expired address is reported as expired, not as bad hash
+	later := s
+	later.NowFunc = func() time.Time { return now.AddDate(0, 0, 30) }
+	if _, _, err := later.ReverseVERP(fwd); err != srs.ErrTimestampExpired {
+		t.Errorf("ReverseVERP %s: expected %v, got %v", fwd, srs.ErrTimestampExpired, err)
+	}
+
+	plain, err := s.Forward("milos@mailspot.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.ReverseVERP(plain); err != srs.ErrNoVERP {
+		t.Errorf("ReverseVERP %s: expected %v, got %v", plain, srs.ErrNoVERP, err)
+	}
+
+	// addresses passed through by Forward can't carry VERP recipient
+	alt := s
+	alt.AltDomains = []string{"alt.com"}
+	for _, email := range []string{"milos@" + localdomain, "milos@alt.com"} {
+		if fwd, err := alt.ForwardVERP(email, "member@lists.example.com"); err != srs.ErrVERPNotRewritten {
+			t.Errorf("ForwardVERP %s: expected %v, got %s %v", email, srs.ErrVERPNotRewritten, fwd, err)
+		}
+	}
+
+	// MaxInputLength applies to address with VERP recipient
+	short := s
+	short.MaxInputLength = 80
+	long := "member-with-long-name@lists.example.com"
+	if _, err := short.Forward("milos@mailspot.com"); err != nil {
+		t.Fatal(err)
+	}
+	if fwd, err := short.ForwardVERP("milos@mailspot.com", long); err != srs.ErrInputTooLong {
+		t.Errorf("ForwardVERP %s: expected %v, got %s %v", long, srs.ErrInputTooLong, fwd, err)
+	}
+}
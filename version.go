@@ -0,0 +1,72 @@
+package srs
+
+import "errors"
+
+// maxVersion is the newest address format version
+const maxVersion = 1
+
+// Version errors
+var (
+	ErrUnsupportedVersion = errors.New("Unsupported SRS address version")
+	ErrVersionConfig      = errors.New("Version must be 0 or 1")
+)
+
+// versionTag returns version digit prepended to hash field and hash input, or
+// empty string for version 0
+func (srs SRS) versionTag() string {
+	if srs.Version == 0 {
+		return ""
+	}
+	return string(rune('0' + srs.Version))
+}
+
+// fieldVersion returns version of hash field and the field without version
+// digit. Versioned field starts with digit 1-9 followed by tagged or untagged
+// hash, field which is valid tagged hash is version 0.
+func (srs SRS) fieldVersion(field string) (int, string) {
+	if len(field) < 2 || field[0] < '1' || field[0] > '9' || srs.fieldTag(field) != "" {
+		return 0, field
+	}
+	rest := field[1:]
+	if len(rest) == srs.HashLength || srs.fieldTag(rest) != "" {
+		return int(field[0] - '0'), rest
+	}
+	return 0, field
+}
+
+// checkVersion returns ErrUnsupportedVersion if hash field has version newer
+// than Version of the engine
+func (srs SRS) checkVersion(field string) error {
+	if v, _ := srs.fieldVersion(field); v > srs.Version {
+		return ErrUnsupportedVersion
+	}
+	return nil
+}
+
+// inputTag returns version digit and SchemeTag of hash field, as prepended to
+// hash input, and false if SchemeTag is set and the field is untagged
+func (srs SRS) inputTag(field string) (string, bool) {
+	version, rest := srs.fieldVersion(field)
+	tag := srs.fieldTag(rest)
+	if srs.SchemeTag != 0 && tag == "" {
+		return "", false
+	}
+	if version > 0 {
+		tag = string(rune('0'+version)) + tag
+	}
+	return tag, true
+}
+
+// tagDelim separates tag from hash input. It can't appear in parsed address,
+// so host can't be shifted into the tag, like SRS1=mxxxx=example.com to
+// SRS1=xxxx=mexample.com.
+const tagDelim = "\x00"
+
+// tagged returns hash input prepended with tag and tagDelim, or input if tag
+// is empty, so untagged hash input is the same as in default mode
+func tagged(tag, input string) string {
+	if tag == "" {
+		return input
+	}
+	return tag + tagDelim + input
+}
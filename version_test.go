@@ -0,0 +1,108 @@
+package srs_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mileusna/srs"
+)
+
+func TestVersion(t *testing.T) {
+	for _, tag := range []byte{0, 'x'} {
+		v0 := srs.SRS{Secret: []byte(secret), Domain: localdomain, SchemeTag: tag}
+		v1 := srs.SRS{Secret: []byte(secret), Domain: localdomain, SchemeTag: tag, Version: 1}
+
+		for _, email := range []string{"milos@mailspot.com", "SRS0=8Zzm=IS=netmark.rs=milos@domain.com"} {
+			fwd0, err := v0.Forward(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fwd1, err := v1.Forward(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash := strings.Split(fwd1, "=")[1]; hash[0] != '1' || len(hash) != len(strings.Split(fwd0, "=")[1])+1 {
+				t.Errorf("Forward %s: expected version 1 hash field, got %s", email, fwd1)
+			}
+
+			// version 1 engine reverses both versions
+			for _, fwd := range []string{fwd0, fwd1} {
+				if rvs, err := v1.Reverse(fwd); rvs != email || err != nil {
+					t.Errorf("Reverse %s with version 1: expected %s, got %s %v", fwd, email, rvs, err)
+				}
+			}
+			if rvs, err := v0.Reverse(fwd0); rvs != email || err != nil {
+				t.Errorf("Reverse %s with version 0: expected %s, got %s %v", fwd0, email, rvs, err)
+			}
+			if rvs, err := v0.Reverse(fwd1); err != srs.ErrUnsupportedVersion {
+				t.Errorf("Reverse %s with version 0: expected %v, got %s %v", fwd1, srs.ErrUnsupportedVersion, rvs, err)
+			}
+
+			// version digit is covered by hash, so it can't be stripped
+			stripped := strings.Replace(fwd1, "=1", "=", 1)
+			if _, err := v1.Reverse(stripped); err != srs.ErrHashInvalid {
+				t.Errorf("Reverse %s: expected %v, got %v", stripped, srs.ErrHashInvalid, err)
+			}
+			newer := strings.Replace(fwd1, "=1", "=2", 1)
+			if _, err := v1.Reverse(newer); err != srs.ErrUnsupportedVersion {
+				t.Errorf("Reverse %s: expected %v, got %v", newer, srs.ErrUnsupportedVersion, err)
+			}
+		}
+	}
+
+	bad := srs.SRS{Secret: []byte(secret), Domain: localdomain, Version: 2}
+	if err := bad.Validate(); err != srs.ErrVersionConfig {
+		t.Errorf("Validate: expected %v, got %v", srs.ErrVersionConfig, err)
+	}
+}
+
+func TestVersionHashInput(t *testing.T) {
+	for _, tag := range []byte{0, 'x'} {
+		now := time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC)
+		s := srs.SRS{Secret: []byte(secret), Domain: localdomain, SchemeTag: tag, Version: 1, NowFunc: func() time.Time { return now }}
+		for _, email := range []string{"milos@mailspot.com", "SRS0=8Zzm=IS=netmark.rs=milos@domain.com"} {
+			fwd, err := s.Forward(email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			field := strings.Split(fwd, "=")[1]
+
+			// HashInput of forward and reverse is the exact HMAC input
+			for _, addr := range []string{email, fwd} {
+				input, err := s.HashInput(addr)
+				if err != nil {
+					t.Fatalf("HashInput %s: %v", addr, err)
+				}
+				if tag := "1" + string(tag); !strings.HasPrefix(input, strings.TrimRight(tag, "\x00")+"\x00") {
+					t.Errorf("HashInput %s: expected delimited version digit, got %q", addr, input)
+				}
+				mac := hmac.New(sha1.New, []byte(secret))
+				mac.Write([]byte(input))
+				hash := base64.StdEncoding.EncodeToString(mac.Sum(nil))[:4]
+				if expected := field[:len(field)-4] + hash; !strings.EqualFold(field, expected) {
+					t.Errorf("HashInput %s: HMAC of %q is %s, hash field is %s", addr, input, expected, field)
+				}
+			}
+		}
+	}
+}
+
+func TestVersionShiftedHost(t *testing.T) {
+	s := srs.SRS{Secret: []byte(secret), Domain: localdomain, Version: 1}
+	fwd, err := s.Forward("SRS0=8Zzm=IS=netmark.rs=milos@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// version digit moved from hash field to the beginning of host, so the
+	// field looks like version 0 which the engine still accepts
+	forged := strings.Replace(fwd, "SRS1=1", "SRS1=", 1)
+	forged = strings.Replace(forged, "=example.com==", "=1example.com==", 1)
+	if rvs, err := s.Reverse(forged); err != srs.ErrHashInvalid {
+		t.Errorf("Reverse %s: expected %v, got %s %v", forged, srs.ErrHashInvalid, rvs, err)
+	}
+}